@@ -0,0 +1,128 @@
+package common
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+)
+
+// Attributes attached to a node or edge, e.g. OSM tags and road widths.
+// The maps are created lazily, so the zero value is ready to use.
+type Attributes struct {
+	Tags map[string]string `json:"tags,omitempty"`
+	Values map[string]float64 `json:"values,omitempty"`
+}
+
+func (attrs Attributes) IsEmpty() bool {
+	return len(attrs.Tags) == 0 && len(attrs.Values) == 0
+}
+
+func (attrs *Attributes) SetTag(k string, val string) {
+	if attrs.Tags == nil {
+		attrs.Tags = make(map[string]string)
+	}
+	attrs.Tags[k] = val
+}
+
+func (attrs Attributes) GetTag(k string) (string, bool) {
+	val, ok := attrs.Tags[k]
+	return val, ok
+}
+
+func (attrs *Attributes) SetValue(k string, val float64) {
+	if attrs.Values == nil {
+		attrs.Values = make(map[string]float64)
+	}
+	attrs.Values[k] = val
+}
+
+func (attrs Attributes) GetValue(k string) (float64, bool) {
+	val, ok := attrs.Values[k]
+	return val, ok
+}
+
+// Returns a deep copy so that modifying the copy does not affect the original.
+func (attrs Attributes) Clone() Attributes {
+	var other Attributes
+	for k, val := range attrs.Tags {
+		other.SetTag(k, val)
+	}
+	for k, val := range attrs.Values {
+		other.SetValue(k, val)
+	}
+	return other
+}
+
+// Attributes of a graph keyed by node and edge ID, as stored alongside a graph file.
+type graphAttributes struct {
+	Nodes map[int]Attributes `json:"nodes,omitempty"`
+	Edges map[int]Attributes `json:"edges,omitempty"`
+}
+
+func (graph *Graph) getAttributes() graphAttributes {
+	attrs := graphAttributes{
+		Nodes: make(map[int]Attributes),
+		Edges: make(map[int]Attributes),
+	}
+	for _, node := range graph.Nodes {
+		if !node.Attributes.IsEmpty() {
+			attrs.Nodes[node.ID] = node.Attributes
+		}
+	}
+	for _, edge := range graph.Edges {
+		if !edge.Attributes.IsEmpty() {
+			attrs.Edges[edge.ID] = edge.Attributes
+		}
+	}
+	return attrs
+}
+
+func (graph *Graph) setAttributes(attrs graphAttributes) {
+	for id, nodeAttrs := range attrs.Nodes {
+		if id >= 0 && id < len(graph.Nodes) {
+			graph.Nodes[id].Attributes = nodeAttrs
+		}
+	}
+	for id, edgeAttrs := range attrs.Edges {
+		if id >= 0 && id < len(graph.Edges) {
+			graph.Edges[id].Attributes = edgeAttrs
+		}
+	}
+}
+
+// Graph.Write stores attributes in a JSON file next to the graph file, since the text
+// graph format has no room for them.
+func attributesFname(fname string) string {
+	return fname + ".attrs"
+}
+
+func (graph *Graph) writeAttributes(fname string) error {
+	attrs := graph.getAttributes()
+	if len(attrs.Nodes) == 0 && len(attrs.Edges) == 0 {
+		// remove any stale attributes from a previous graph at this path
+		if err := os.Remove(attributesFname(fname)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	bytes, err := json.Marshal(attrs)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(attributesFname(fname), bytes, 0644)
+}
+
+func (graph *Graph) readAttributes(fname string) error {
+	bytes, err := ioutil.ReadFile(attributesFname(fname))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var attrs graphAttributes
+	if err := json.Unmarshal(bytes, &attrs); err != nil {
+		return err
+	}
+	graph.setAttributes(attrs)
+	return nil
+}
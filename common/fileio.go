@@ -0,0 +1,21 @@
+package common
+
+import (
+	"io"
+	"os"
+)
+
+// Create fname and write it with write, which is usually one of the io.Writer variants
+// of the graph and trace writers. Errors from write and from closing the file are
+// returned.
+func writeFile(fname string, write func(io.Writer) error) error {
+	file, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
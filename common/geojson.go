@@ -0,0 +1,369 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+)
+
+type geojsonGeometry struct {
+	Type string `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// When reading, coordinates are decoded later since their shape depends on the type.
+type geojsonRawGeometry struct {
+	Type string `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+type geojsonFeature struct {
+	Type string `json:"type"`
+	Geometry geojsonGeometry `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geojsonRawFeature struct {
+	Type string `json:"type"`
+	Geometry geojsonRawGeometry `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+func makeGeoJSONFeature(geometryType string, coordinates interface{}, properties map[string]interface{}) geojsonFeature {
+	return geojsonFeature{
+		Type: "Feature",
+		Geometry: geojsonGeometry{geometryType, coordinates},
+		Properties: properties,
+	}
+}
+
+func writeGeoJSON(w io.Writer, features []geojsonFeature) error {
+	collection := struct {
+		Type string `json:"type"`
+		Features []geojsonFeature `json:"features"`
+	}{"FeatureCollection", features}
+	bytes, err := json.Marshal(collection)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(bytes)
+	return err
+}
+
+func readGeoJSON(r io.Reader) ([]geojsonRawFeature, error) {
+	bytes, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var collection struct {
+		Features []geojsonRawFeature `json:"features"`
+	}
+	if err := json.Unmarshal(bytes, &collection); err != nil {
+		return nil, fmt.Errorf("error decoding GeoJSON: %v", err)
+	}
+	return collection.Features, nil
+}
+
+// Reserved feature properties for graphs; other properties are attributes.
+var geojsonGraphProperties = map[string]bool{"id": true, "src": true, "dst": true}
+
+// Attributes with reserved names are not written since they would replace the IDs.
+func attributesToProperties(attrs Attributes, properties map[string]interface{}) {
+	for k, val := range attrs.Tags {
+		if !geojsonGraphProperties[k] {
+			properties[k] = val
+		}
+	}
+	for k, val := range attrs.Values {
+		if !geojsonGraphProperties[k] {
+			properties[k] = val
+		}
+	}
+}
+
+func propertiesToAttributes(properties map[string]interface{}) Attributes {
+	var attrs Attributes
+	for k, val := range properties {
+		if geojsonGraphProperties[k] {
+			continue
+		}
+		switch val := val.(type) {
+		case string:
+			attrs.SetTag(k, val)
+		case float64:
+			attrs.SetValue(k, val)
+		case bool:
+			attrs.SetTag(k, fmt.Sprintf("%v", val))
+		}
+	}
+	return attrs
+}
+
+// Write the graph as a GeoJSON FeatureCollection.
+// Each node is a Point feature with its ID in the "id" property, and each edge is a
+// LineString feature with "id", "src" and "dst" properties. Attributes are written as
+// additional properties. Coordinates are written as is, so the graph should be in
+// longitude/latitude for other tools to place it correctly.
+func (graph *Graph) WriteGeoJSON(fname string) error {
+	return writeFile(fname, graph.WriteGeoJSONTo)
+}
+
+func (graph *Graph) WriteGeoJSONTo(w io.Writer) error {
+	var features []geojsonFeature
+	for _, node := range graph.Nodes {
+		properties := map[string]interface{}{"id": node.ID}
+		attributesToProperties(node.Attributes, properties)
+		features = append(features, makeGeoJSONFeature("Point", [2]float64{node.Point.X, node.Point.Y}, properties))
+	}
+	for _, edge := range graph.Edges {
+		properties := map[string]interface{}{
+			"id": edge.ID,
+			"src": edge.Src.ID,
+			"dst": edge.Dst.ID,
+		}
+		attributesToProperties(edge.Attributes, properties)
+		coordinates := [][2]float64{
+			{edge.Src.Point.X, edge.Src.Point.Y},
+			{edge.Dst.Point.X, edge.Dst.Point.Y},
+		}
+		features = append(features, makeGeoJSONFeature("LineString", coordinates, properties))
+	}
+	return writeGeoJSON(w, features)
+}
+
+// Read a graph from GeoJSON.
+// Files written by WriteGeoJSON are read back exactly. Other files are also supported:
+// Point features become nodes, and each LineString or MultiLineString becomes a chain of
+// edges in the order of its coordinates, where vertices at the same coordinates are
+// shared. Use MakeBidirectional if the lines are not directed.
+func ReadGeoJSONGraph(fname string) (*Graph, error) {
+	file, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadGeoJSONGraphFrom(file)
+}
+
+func ReadGeoJSONGraphFrom(r io.Reader) (*Graph, error) {
+	features, err := readGeoJSON(r)
+	if err != nil {
+		return nil, err
+	}
+	graph := &Graph{}
+	nodesByID := make(map[int]*Node)
+	nodesByPoint := make(map[Point]*Node)
+	getID := func(properties map[string]interface{}, k string) (int, bool) {
+		val, ok := properties[k].(float64)
+		return int(val), ok
+	}
+	getNode := func(p Point) *Node {
+		if nodesByPoint[p] == nil {
+			nodesByPoint[p] = graph.AddNode(p)
+		}
+		return nodesByPoint[p]
+	}
+
+	// add nodes first so that edges can refer to them
+	for _, feature := range features {
+		if feature.Geometry.Type != "Point" {
+			continue
+		}
+		var coordinates [2]float64
+		if err := json.Unmarshal(feature.Geometry.Coordinates, &coordinates); err != nil {
+			return nil, fmt.Errorf("bad Point coordinates: %v", err)
+		}
+		node := graph.AddNode(Point{coordinates[0], coordinates[1]})
+		node.Attributes = propertiesToAttributes(feature.Properties)
+		if id, ok := getID(feature.Properties, "id"); ok {
+			nodesByID[id] = node
+		}
+		if nodesByPoint[node.Point] == nil {
+			nodesByPoint[node.Point] = node
+		}
+	}
+
+	for _, feature := range features {
+		var lines [][][2]float64
+		switch feature.Geometry.Type {
+		case "LineString":
+			var line [][2]float64
+			if err := json.Unmarshal(feature.Geometry.Coordinates, &line); err != nil {
+				return nil, fmt.Errorf("bad LineString coordinates: %v", err)
+			}
+			lines = append(lines, line)
+		case "MultiLineString":
+			if err := json.Unmarshal(feature.Geometry.Coordinates, &lines); err != nil {
+				return nil, fmt.Errorf("bad MultiLineString coordinates: %v", err)
+			}
+		default:
+			continue
+		}
+		attrs := propertiesToAttributes(feature.Properties)
+		srcID, hasSrc := getID(feature.Properties, "src")
+		dstID, hasDst := getID(feature.Properties, "dst")
+		for _, line := range lines {
+			if len(line) < 2 {
+				continue
+			}
+			var nodes []*Node
+			for i, coordinates := range line {
+				if i == 0 && hasSrc && nodesByID[srcID] != nil {
+					nodes = append(nodes, nodesByID[srcID])
+				} else if i == len(line) - 1 && hasDst && nodesByID[dstID] != nil {
+					nodes = append(nodes, nodesByID[dstID])
+				} else {
+					nodes = append(nodes, getNode(Point{coordinates[0], coordinates[1]}))
+				}
+			}
+			for i := 1; i < len(nodes); i++ {
+				graph.AddEdge(nodes[i - 1], nodes[i]).Attributes = attrs.Clone()
+			}
+		}
+	}
+	return graph, nil
+}
+
+// Write traces as GeoJSON.
+// If points is false, each trace is a LineString feature, with the trace name in the
+// "name" property and observation timestamps (RFC 3339) in the "times" property.
+// If points is true, each observation is a Point feature with "trace" (the trace index),
+// "name", "index" and "time" properties, along with the observation metadata.
+func SaveGeoJSONTraces(fname string, traces Traces, points bool) error {
+	return writeFile(fname, func(w io.Writer) error {
+		return SaveGeoJSONTracesTo(w, traces, points)
+	})
+}
+
+func SaveGeoJSONTracesTo(w io.Writer, traces Traces, points bool) error {
+	var features []geojsonFeature
+	for traceIdx, trace := range traces {
+		if !points {
+			var coordinates [][2]float64
+			var times []string
+			for _, obs := range trace.Observations {
+				coordinates = append(coordinates, [2]float64{obs.Point.X, obs.Point.Y})
+				times = append(times, obs.Time.Format(time.RFC3339Nano))
+			}
+			properties := map[string]interface{}{
+				"name": trace.Name,
+				"times": times,
+			}
+			features = append(features, makeGeoJSONFeature("LineString", coordinates, properties))
+			continue
+		}
+		for i, obs := range trace.Observations {
+			properties := make(map[string]interface{})
+			for k, val := range obs.Metadata {
+				properties[k] = val
+			}
+			properties["trace"] = traceIdx
+			properties["name"] = trace.Name
+			properties["index"] = i
+			properties["time"] = obs.Time.Format(time.RFC3339Nano)
+			features = append(features, makeGeoJSONFeature("Point", [2]float64{obs.Point.X, obs.Point.Y}, properties))
+		}
+	}
+	return writeGeoJSON(w, features)
+}
+
+// Load traces written by SaveGeoJSONTraces (in either form).
+// Point features without a "trace" property are treated as a single trace.
+func LoadGeoJSONTraces(fname string) (Traces, error) {
+	file, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return LoadGeoJSONTracesFrom(file)
+}
+
+func LoadGeoJSONTracesFrom(r io.Reader) (Traces, error) {
+	features, err := readGeoJSON(r)
+	if err != nil {
+		return nil, err
+	}
+	parseTime := func(val interface{}) (time.Time, error) {
+		s, ok := val.(string)
+		if !ok {
+			return time.Time{}, nil
+		}
+		return time.Parse(time.RFC3339Nano, s)
+	}
+
+	var traces Traces
+	type indexedObservation struct {
+		index float64
+		obs *Observation
+	}
+	pointTraces := make(map[float64]*Trace)
+	pointObservations := make(map[float64][]indexedObservation)
+	var pointTraceIDs []float64
+	for _, feature := range features {
+		switch feature.Geometry.Type {
+		case "LineString":
+			var line [][2]float64
+			if err := json.Unmarshal(feature.Geometry.Coordinates, &line); err != nil {
+				return nil, fmt.Errorf("bad LineString coordinates: %v", err)
+			}
+			trace := &Trace{}
+			trace.Name, _ = feature.Properties["name"].(string)
+			times, _ := feature.Properties["times"].([]interface{})
+			for i, coordinates := range line {
+				obs := &Observation{Point: Point{coordinates[0], coordinates[1]}}
+				if i < len(times) {
+					obs.Time, err = parseTime(times[i])
+					if err != nil {
+						return nil, fmt.Errorf("bad time: %v", err)
+					}
+				}
+				trace.Observations = append(trace.Observations, obs)
+			}
+			traces = append(traces, trace)
+		case "Point":
+			var coordinates [2]float64
+			if err := json.Unmarshal(feature.Geometry.Coordinates, &coordinates); err != nil {
+				return nil, fmt.Errorf("bad Point coordinates: %v", err)
+			}
+			obs := &Observation{Point: Point{coordinates[0], coordinates[1]}}
+			obs.Time, err = parseTime(feature.Properties["time"])
+			if err != nil {
+				return nil, fmt.Errorf("bad time: %v", err)
+			}
+			for k, val := range feature.Properties {
+				if k != "trace" && k != "name" && k != "index" && k != "time" {
+					obs.SetMetadata(k, val)
+				}
+			}
+			traceID, _ := feature.Properties["trace"].(float64)
+			if pointTraces[traceID] == nil {
+				pointTraces[traceID] = &Trace{}
+				pointTraces[traceID].Name, _ = feature.Properties["name"].(string)
+				pointTraceIDs = append(pointTraceIDs, traceID)
+			}
+			index, ok := feature.Properties["index"].(float64)
+			if !ok {
+				index = float64(len(pointObservations[traceID]))
+			}
+			pointObservations[traceID] = append(pointObservations[traceID], indexedObservation{index, obs})
+		}
+	}
+
+	sort.Float64s(pointTraceIDs)
+	for _, traceID := range pointTraceIDs {
+		observations := pointObservations[traceID]
+		sort.SliceStable(observations, func(i, j int) bool {
+			return observations[i].index < observations[j].index
+		})
+		trace := pointTraces[traceID]
+		for _, iobs := range observations {
+			trace.Observations = append(trace.Observations, iobs.obs)
+		}
+		traces = append(traces, trace)
+	}
+	return traces, nil
+}
@@ -0,0 +1,121 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGeoJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "geojson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	graph := &Graph{}
+	a := graph.AddNode(Point{-71.1, 42.3})
+	b := graph.AddNode(Point{-71.0, 42.3})
+	c := graph.AddNode(Point{-71.0, 42.4})
+	graph.AddBidirectionalEdge(a, b)
+	graph.AddEdge(b, c).Attributes.SetTag("oneway", "yes")
+	graph.Edges[2].Attributes.SetValue("width", 3.5)
+	c.Attributes.SetTag("highway", "stop")
+	// reserved names do not replace the IDs
+	graph.Edges[0].Attributes.SetTag("src", "bogus")
+	c.Attributes.SetValue("id", 100)
+	graph.AddNode(Point{-71.2, 42.5})
+
+	fname := filepath.Join(dir, "graph.geojson")
+	if err := graph.WriteGeoJSON(fname); err != nil {
+		t.Fatal(err)
+	}
+	other, err := ReadGeoJSONGraph(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	features, err := readGeoJSON(file)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := features[c.ID].Properties["id"]; id != float64(c.ID) {
+		t.Fatalf("node ID was replaced by attribute: %v", id)
+	}
+	if src := features[len(graph.Nodes)].Properties["src"]; src != float64(a.ID) {
+		t.Fatalf("edge src was replaced by attribute: %v", src)
+	}
+	if len(other.Nodes) != len(graph.Nodes) || len(other.Edges) != len(graph.Edges) {
+		t.Fatalf("expected %d nodes and %d edges but got %d and %d", len(graph.Nodes), len(graph.Edges), len(other.Nodes), len(other.Edges))
+	}
+	for i, edge := range graph.Edges {
+		if other.Edges[i].Src.ID != edge.Src.ID || other.Edges[i].Dst.ID != edge.Dst.ID {
+			t.Fatalf("edge %d was not read back", i)
+		}
+	}
+	if tag, _ := other.Edges[2].Attributes.GetTag("oneway"); tag != "yes" {
+		t.Fatalf("edge attributes were not read back")
+	}
+	if width, _ := other.Edges[2].Attributes.GetValue("width"); width != 3.5 {
+		t.Fatalf("edge attributes were not read back")
+	}
+	if tag, _ := other.Nodes[c.ID].Attributes.GetTag("highway"); tag != "stop" {
+		t.Fatalf("node attributes were not read back")
+	}
+
+	// a line from another tool, without node features, that shares a vertex with a
+	// second line
+	foreign := `{"type": "FeatureCollection", "features": [
+		{"type": "Feature", "properties": {"name": "A"}, "geometry": {"type": "LineString", "coordinates": [[0, 0], [1, 0], [2, 0]]}},
+		{"type": "Feature", "properties": {}, "geometry": {"type": "LineString", "coordinates": [[1, 0], [1, 1]]}}
+	]}`
+	fname = filepath.Join(dir, "foreign.geojson")
+	if err := ioutil.WriteFile(fname, []byte(foreign), 0644); err != nil {
+		t.Fatal(err)
+	}
+	other, err = ReadGeoJSONGraph(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(other.Nodes) != 4 || len(other.Edges) != 3 || len(other.Nodes[1].Out) != 2 {
+		t.Fatalf("bad graph from foreign GeoJSON: %d nodes, %d edges", len(other.Nodes), len(other.Edges))
+	}
+
+	start := time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC)
+	traces := Traces{
+		{Name: "first", Observations: []*Observation{
+			{Time: start, Point: Point{-71.1, 42.3}},
+			{Time: start.Add(time.Second), Point: Point{-71.0, 42.3}},
+		}},
+		{Name: "second", Observations: []*Observation{
+			{Time: start, Point: Point{-71.0, 42.4}},
+		}},
+	}
+	traces[0].Observations[1].SetMetadata("speed", 12.5)
+	for _, points := range []bool{false, true} {
+		fname = filepath.Join(dir, "traces.geojson")
+		if err := SaveGeoJSONTraces(fname, traces, points); err != nil {
+			t.Fatal(err)
+		}
+		otherTraces, err := LoadGeoJSONTraces(fname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(otherTraces) != 2 || len(otherTraces[0].Observations) != 2 || otherTraces[1].Name != "second" {
+			t.Fatalf("traces were not read back (points=%v)", points)
+		}
+		obs := otherTraces[0].Observations[1]
+		if !obs.Time.Equal(start.Add(time.Second)) || obs.Point != traces[0].Observations[1].Point {
+			t.Fatalf("bad observation %v (points=%v)", obs, points)
+		}
+		if points && obs.Metadata["speed"] != 12.5 {
+			t.Fatalf("observation metadata was not read back")
+		}
+	}
+}
@@ -523,3 +523,94 @@ func GetConvexHull(points []Point) Polygon {
 
 	return hull[0:len(hull)-1]
 }
+
+// Concave hull using the gift-opening approach of Park and Oh (2012).
+// Starting from the convex hull, each hull edge longer than lengthThreshold is replaced
+// by two edges through the closest interior point, provided that the edge is more than
+// concavity times longer than the distance from that point to the nearer endpoint and
+// the hull stays simple. Smaller concavity gives a tighter hull, while concavity of +Inf
+// yields the convex hull.
+func GetConcaveHull(points []Point, concavity float64, lengthThreshold float64) Polygon {
+	// GetConvexHull does not handle duplicate points
+	var unique []Point
+	seen := make(map[Point]bool)
+	for _, p := range points {
+		if !seen[p] {
+			unique = append(unique, p)
+			seen[p] = true
+		}
+	}
+	hull := GetConvexHull(append([]Point{}, unique...))
+	if len(hull) < 3 {
+		return hull
+	}
+	onHull := make(map[Point]bool)
+	for _, p := range hull {
+		onHull[p] = true
+	}
+	var inside []Point
+	for _, p := range unique {
+		if !onHull[p] {
+			inside = append(inside, p)
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for i := 0; i < len(hull); i++ {
+			n := len(hull)
+			a := hull[i]
+			b := hull[(i+1)%n]
+			edge := Segment{a, b}
+			length := edge.Length()
+			if length <= lengthThreshold {
+				continue
+			}
+
+			// find the closest interior point that is not closer to a neighboring hull edge
+			prevEdge := Segment{hull[(i+n-1)%n], a}
+			nextEdge := Segment{b, hull[(i+2)%n]}
+			bestIdx := -1
+			var bestDistance float64
+			for j, p := range inside {
+				d := edge.Distance(p)
+				if bestIdx != -1 && d >= bestDistance {
+					continue
+				} else if d > prevEdge.Distance(p) || d > nextEdge.Distance(p) {
+					continue
+				}
+				bestIdx = j
+				bestDistance = d
+			}
+			if bestIdx == -1 {
+				continue
+			}
+			p := inside[bestIdx]
+			dd := math.Min(p.Distance(a), p.Distance(b))
+			if dd == 0 || length / dd <= concavity {
+				continue
+			}
+
+			// the new edges must not cross the rest of the hull
+			ok := true
+			for k := range hull {
+				if k == (i+n-1)%n || k == i || k == (i+1)%n {
+					continue
+				}
+				other := Segment{hull[k], hull[(k+1)%n]}
+				if other.Intersection(Segment{a, p}) != nil || other.Intersection(Segment{p, b}) != nil {
+					ok = false
+					break
+				}
+			}
+			if !ok {
+				continue
+			}
+
+			hull = append(hull[:i+1], append(Polygon{p}, hull[i+1:]...)...)
+			inside = append(inside[:bestIdx], inside[bestIdx+1:]...)
+			changed = true
+		}
+	}
+	return hull
+}
@@ -4,7 +4,9 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"math"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -14,6 +16,7 @@ type Node struct {
 	Point Point
 	In []*Edge
 	Out []*Edge
+	Attributes Attributes
 }
 
 func (node *Node) String() string {
@@ -39,6 +42,7 @@ type Edge struct {
 	ID int
 	Src *Node
 	Dst *Node
+	Attributes Attributes
 }
 
 func (edge *Edge) Segment() Segment {
@@ -157,17 +161,165 @@ func (graph *Graph) AddBidirectionalEdge(v1 *Node, v2 *Node) [2]*Edge {
 	return [2]*Edge{edge1, edge2}
 }
 
+// Remove an edge from the graph.
+// The edge's slot in graph.Edges is set to nil so that the IDs of other edges are not
+// affected, which keeps removal cheap and lets callers keep using their own tables
+// keyed by ID while editing. Other Graph methods expect ID == index, so call Compact
+// once done editing and before using the graph with anything else.
+func (graph *Graph) RemoveEdge(edge *Edge) {
+	if edge.ID >= len(graph.Edges) || graph.Edges[edge.ID] != edge {
+		return
+	}
+	edge.Src.RemoveEdge(edge)
+	edge.Dst.RemoveEdge(edge)
+	graph.Edges[edge.ID] = nil
+}
+
+// Remove a node and all of its incident edges from the graph.
+// Like RemoveEdge, this leaves nil slots that are cleared by Compact.
+func (graph *Graph) RemoveNode(node *Node) {
+	if node.ID >= len(graph.Nodes) || graph.Nodes[node.ID] != node {
+		return
+	}
+	for _, edge := range append(append([]*Edge{}, node.In...), node.Out...) {
+		graph.RemoveEdge(edge)
+	}
+	graph.Nodes[node.ID] = nil
+}
+
+// Drop removed nodes and edges and renumber the rest so that ID == index again.
+// Returns maps from old node and edge IDs to new IDs for the entries that remain.
+func (graph *Graph) Compact() (map[int]int, map[int]int) {
+	nodeMap := make(map[int]int)
+	edgeMap := make(map[int]int)
+	var nodes []*Node
+	for _, node := range graph.Nodes {
+		if node == nil {
+			continue
+		}
+		nodeMap[node.ID] = len(nodes)
+		node.ID = len(nodes)
+		nodes = append(nodes, node)
+	}
+	var edges []*Edge
+	for _, edge := range graph.Edges {
+		if edge == nil {
+			continue
+		}
+		edgeMap[edge.ID] = len(edges)
+		edge.ID = len(edges)
+		edges = append(edges, edge)
+	}
+	graph.Nodes = nodes
+	graph.Edges = edges
+	return nodeMap, edgeMap
+}
+
+type CropOptions struct {
+	// Only keep edges with both endpoints inside the region, instead of clipping edges
+	// that cross the boundary.
+	NoClip bool
+}
+
+// Returns the part of the graph inside the rectangle; edges that cross the boundary are
+// clipped at the boundary.
 func (graph *Graph) GetSubgraphInRect(r Rectangle) *Graph {
+	return graph.CropRect(r, CropOptions{})
+}
+
+func (graph *Graph) CropRect(r Rectangle, options CropOptions) *Graph {
+	return graph.crop(r.ToPolygon(), r.Contains, options)
+}
+
+// Like CropRect but for an arbitrary polygon region.
+func (graph *Graph) Crop(region Polygon, options CropOptions) *Graph {
+	return graph.crop(region, region.Contains, options)
+}
+
+func (graph *Graph) crop(region Polygon, contains func(Point) bool, options CropOptions) *Graph {
 	ngraph := &Graph{}
 	nodeMap := make(map[int]*Node)
 	for _, node := range graph.Nodes {
-		if r.Contains(node.Point) {
+		if contains(node.Point) {
 			nodeMap[node.ID] = ngraph.AddNode(node.Point)
+			nodeMap[node.ID].Attributes = node.Attributes.Clone()
 		}
 	}
+	// clipped pieces of different edges can share both endpoints, so only the first
+	// one is kept (and keeps its attributes)
+	addEdge := func(src *Node, dst *Node, edge *Edge) {
+		if ngraph.FindEdge(src, dst) == nil {
+			ngraph.AddEdge(src, dst).Attributes = edge.Attributes.Clone()
+		}
+	}
+	bounds := region.Bounds()
+	segments := region.Segments()
+	// boundary nodes keyed by intersection point, so that both directions of a
+	// bidirectional edge share them
+	boundaryNodes := make(map[Point]*Node)
+	// a cut is either an endpoint of the edge or an intersection with the boundary
+	type cut struct {
+		position float64
+		node *Node
+		point Point
+	}
+	getNode := func(c cut) *Node {
+		if c.node == nil {
+			if boundaryNodes[c.point] == nil {
+				boundaryNodes[c.point] = ngraph.AddNode(c.point)
+			}
+			return boundaryNodes[c.point]
+		}
+		if nodeMap[c.node.ID] == nil {
+			nodeMap[c.node.ID] = ngraph.AddNode(c.node.Point)
+			nodeMap[c.node.ID].Attributes = c.node.Attributes.Clone()
+		}
+		return nodeMap[c.node.ID]
+	}
 	for _, edge := range graph.Edges {
-		if nodeMap[edge.Src.ID] != nil && nodeMap[edge.Dst.ID] != nil {
-			ngraph.AddEdge(nodeMap[edge.Src.ID], nodeMap[edge.Dst.ID])
+		if options.NoClip {
+			if nodeMap[edge.Src.ID] != nil && nodeMap[edge.Dst.ID] != nil {
+				ngraph.AddEdge(nodeMap[edge.Src.ID], nodeMap[edge.Dst.ID]).Attributes = edge.Attributes.Clone()
+			}
+			continue
+		} else if !bounds.Intersects(edge.Segment().Bounds()) {
+			continue
+		}
+
+		// compute the intersections on the segment in a canonical direction so that
+		// the reverse edge gets exactly the same points
+		segment := edge.Segment()
+		canonical := segment
+		if edge.Src.ID > edge.Dst.ID {
+			canonical = Segment{segment.End, segment.Start}
+		}
+		cuts := []cut{{0, edge.Src, edge.Src.Point}, {segment.Length(), edge.Dst, edge.Dst.Point}}
+		for _, polySegment := range segments {
+			intersection := polySegment.Intersection(canonical)
+			if intersection == nil {
+				continue
+			}
+			position := segment.Project(*intersection, false)
+			if position < 1e-9 || position > segment.Length() - 1e-9 {
+				continue
+			}
+			cuts = append(cuts, cut{position, nil, *intersection})
+		}
+		sort.Slice(cuts, func(i, j int) bool {
+			return cuts[i].position < cuts[j].position
+		})
+		for i := 1; i < len(cuts); i++ {
+			if cuts[i].position - cuts[i - 1].position < 1e-9 {
+				continue
+			}
+			mid := segment.PointAtFactor((cuts[i - 1].position + cuts[i].position) / 2, false)
+			if !contains(mid) {
+				continue
+			}
+			src, dst := getNode(cuts[i - 1]), getNode(cuts[i])
+			if src != dst {
+				addEdge(src, dst, edge)
+			}
 		}
 	}
 	return ngraph
@@ -175,17 +327,19 @@ func (graph *Graph) GetSubgraphInRect(r Rectangle) *Graph {
 
 func (graph *Graph) MakeBidirectional() {
 	for _, edge := range graph.Edges {
-		graph.AddEdge(edge.Dst, edge.Src)
+		if graph.FindEdge(edge.Dst, edge.Src) == nil {
+			graph.AddEdge(edge.Dst, edge.Src).Attributes = edge.Attributes.Clone()
+		}
 	}
 }
 
 func (graph *Graph) Clone() *Graph {
 	other := &Graph{}
 	for _, node := range graph.Nodes {
-		other.AddNode(node.Point)
+		other.AddNode(node.Point).Attributes = node.Attributes.Clone()
 	}
 	for _, edge := range graph.Edges {
-		other.AddEdge(other.Nodes[edge.Src.ID], other.Nodes[edge.Dst.ID])
+		other.AddEdge(other.Nodes[edge.Src.ID], other.Nodes[edge.Dst.ID]).Attributes = edge.Attributes.Clone()
 	}
 	return other
 }
@@ -201,9 +355,11 @@ func (graph *Graph) FilterEdgesWithMaps(badEdges map[int]bool) (*Graph, map[int]
 		for _, node := range []*Node{edge.Src, edge.Dst} {
 			if nodeMap[node.ID] == nil {
 				nodeMap[node.ID] = other.AddNode(node.Point)
+				nodeMap[node.ID].Attributes = node.Attributes.Clone()
 			}
 		}
 		nedge := other.AddEdge(nodeMap[edge.Src.ID], nodeMap[edge.Dst.ID])
+		nedge.Attributes = edge.Attributes.Clone()
 		edgeMap[edge.ID] = nedge
 	}
 	return other, nodeMap, edgeMap
@@ -214,14 +370,40 @@ func (graph *Graph) FilterEdges(badEdges map[int]bool) *Graph {
 	return ngraph
 }
 
+// Read a graph written by Graph.Write, in either the text or the binary format.
 func ReadGraph(fname string) (*Graph, error) {
 	file, err := os.Open(fname)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
+	graph, binary, err := readGraph(file)
+	if err != nil {
+		return nil, err
+	}
+	// the text format keeps attributes in a separate file
+	if !binary {
+		if err := graph.readAttributes(fname); err != nil {
+			return nil, err
+		}
+	}
+	return graph, nil
+}
+
+// Like ReadGraph but reads from a stream, e.g. a gzip.Reader or HTTP response body.
+// Attributes are only read for the binary format, since the text format stores them in
+// a separate file.
+func ReadGraphFrom(r io.Reader) (*Graph, error) {
+	graph, _, err := readGraph(r)
+	return graph, err
+}
 
-	reader := bufio.NewReader(file)
+func readGraph(r io.Reader) (*Graph, bool, error) {
+	reader := bufio.NewReader(r)
+	if magic, err := reader.Peek(len(GRAPH_BINARY_MAGIC)); err == nil && string(magic) == GRAPH_BINARY_MAGIC {
+		graph, err := ReadBinaryGraph(reader)
+		return graph, true, err
+	}
 	section := "vertices"
 	var graph Graph
 
@@ -231,7 +413,7 @@ func ReadGraph(fname string) (*Graph, error) {
 			if err == io.EOF {
 				break
 			} else {
-				return nil, err
+				return nil, false, err
 			}
 		}
 		line = strings.TrimSpace(line)
@@ -242,54 +424,69 @@ func ReadGraph(fname string) (*Graph, error) {
 			}
 			parts := strings.Split(line, " ")
 			if len(parts) != 2 {
-				return nil, fmt.Errorf("invalid vertex line: %s", line)
+				return nil, false, fmt.Errorf("invalid vertex line: %s", line)
 			}
 			x, errx := strconv.ParseFloat(parts[0], 64)
 			y, erry := strconv.ParseFloat(parts[1], 64)
 			if errx != nil || erry != nil {
-				return nil, fmt.Errorf("invalid vertex line: %s", line)
+				return nil, false, fmt.Errorf("invalid vertex line: %s", line)
 			}
 			graph.AddNode(Point{x, y})
 		} else if section == "edges" && line != "" {
 			parts := strings.Split(line, " ")
 			if len(parts) != 2 {
-				return nil, fmt.Errorf("invalid edge line: %s", line)
+				return nil, false, fmt.Errorf("invalid edge line: %s", line)
 			}
 			src, errsrc := strconv.Atoi(parts[0])
 			dst, errdst := strconv.Atoi(parts[1])
 			if errsrc != nil || errdst != nil {
-				return nil, fmt.Errorf("invalid edge line: %s", line)
+				return nil, false, fmt.Errorf("invalid edge line: %s", line)
 			}
 			graph.AddEdge(graph.Nodes[src], graph.Nodes[dst])
 		}
 	}
 
-	return &graph, nil
+	return &graph, false, nil
 }
 
+// Write the graph in the text format, or in the binary format (see WriteBinaryTo) if
+// fname ends with GRAPH_BINARY_EXT.
+// In the text format, attributes are written to fname + ".attrs". If the graph has no
+// attributes, any existing fname + ".attrs" is deleted so that ReadGraph does not attach
+// attributes from an older graph at the same path. The binary format always deletes it.
 func (graph *Graph) Write(fname string) error {
-	file, err := os.Create(fname)
-	if err != nil {
+	if strings.HasSuffix(fname, GRAPH_BINARY_EXT) {
+		return graph.WriteBinary(fname)
+	}
+	if err := writeFile(fname, graph.WriteTextTo); err != nil {
 		return err
 	}
-	defer file.Close()
+	return graph.writeAttributes(fname)
+}
+
+// Write the graph in the text format to a stream. Attributes are not included; use
+// WriteBinaryTo to keep them.
+func (graph *Graph) WriteTextTo(w io.Writer) error {
+	writer := bufio.NewWriter(w)
 
 	// vertices
 	for _, node := range graph.Nodes {
-		if _, err := file.Write([]byte(fmt.Sprintf("%f %f\n", node.Point.X, node.Point.Y))); err != nil {
+		if _, err := writer.WriteString(fmt.Sprintf("%f %f\n", node.Point.X, node.Point.Y)); err != nil {
 			return err
 		}
 	}
-	file.Write([]byte("\n"))
+	if _, err := writer.WriteString("\n"); err != nil {
+		return err
+	}
 
 	// edges
 	for _, edge := range graph.Edges {
-		if _, err := file.Write([]byte(fmt.Sprintf("%d %d\n", edge.Src.ID, edge.Dst.ID))); err != nil {
+		if _, err := writer.WriteString(fmt.Sprintf("%d %d\n", edge.Src.ID, edge.Dst.ID)); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return writer.Flush()
 }
 
 func (graph *Graph) SplitEdge(edge *Edge, length float64) *Edge {
@@ -303,28 +500,88 @@ func (graph *Graph) SplitEdge(edge *Edge, length float64) *Edge {
 	origDst.RemoveEdge(edge)
 	newNode.In = append(newNode.In, edge)
 	remainderEdge := graph.AddEdge(newNode, origDst)
+	remainderEdge.Attributes = edge.Attributes.Clone()
 
 	if oppEdge != nil {
 		oppEdge.Src = newNode
 		origDst.RemoveEdge(oppEdge)
 		newNode.Out = append(newNode.Out, oppEdge)
-		graph.AddEdge(origDst, newNode)
+		graph.AddEdge(origDst, newNode).Attributes = oppEdge.Attributes.Clone()
 	}
 
 	return remainderEdge
 }
 
+// Position of an edge created by Densify within the original edge that it came from.
+type EdgeOffset struct {
+	EdgeID int
+
+	// distance from the original edge's source to the start of the edge
+	Offset float64
+}
+
+// Split edges in place with SplitEdge so that no edge is longer than maxLength.
+// Each edge is split into equal parts, and the opposite edge of a bidirectional pair is
+// split at the same nodes. Returns a map from every edge ID after densifying to the
+// original edge that it is a part of. maxLength must be positive.
+func (graph *Graph) Densify(maxLength float64) (map[int]EdgeOffset, error) {
+	if !(maxLength > 0) {
+		return nil, fmt.Errorf("maxLength must be positive, got %v", maxLength)
+	}
+	origins := make(map[int]EdgeOffset)
+	numEdges := len(graph.Edges)
+	for _, edge := range graph.Edges[:numEdges] {
+		if _, ok := origins[edge.ID]; ok {
+			continue
+		}
+		origins[edge.ID] = EdgeOffset{edge.ID, 0}
+		opposite := edge.GetOpposite()
+		if opposite != nil {
+			origins[opposite.ID] = EdgeOffset{opposite.ID, 0}
+		}
+
+		segment := edge.Segment()
+		length := segment.Length()
+		if length <= maxLength {
+			continue
+		}
+		// sample the split points along the edge
+		n := int(math.Ceil(length / maxLength))
+		points := segment.Sample(length / float64(n))
+		firstNewID := len(graph.Edges)
+		cur := edge
+		for i := 1; i < n && i < len(points) - 1; i++ {
+			cur = graph.SplitEdge(cur, cur.Segment().Project(points[i], false))
+		}
+
+		// SplitEdge keeps the original edges as the pieces incident to their source
+		for _, nedge := range graph.Edges[firstNewID:] {
+			if opposite != nil && nedge.Vector().Dot(segment.Vector()) < 0 {
+				origins[nedge.ID] = EdgeOffset{opposite.ID, length - segment.Project(nedge.Src.Point, false)}
+			} else {
+				origins[nedge.ID] = EdgeOffset{edge.ID, segment.Project(nedge.Src.Point, false)}
+			}
+		}
+		if opposite != nil {
+			origins[opposite.ID] = EdgeOffset{opposite.ID, length - segment.Project(opposite.Src.Point, false)}
+		}
+	}
+	return origins, nil
+}
+
 func GraphFromEdges(edges []*Edge) *Graph {
 	g := &Graph{}
 	nodemap := make(map[int]*Node)
 	for _, edge := range edges {
 		if nodemap[edge.Src.ID] == nil {
 			nodemap[edge.Src.ID] = g.AddNode(edge.Src.Point)
+			nodemap[edge.Src.ID].Attributes = edge.Src.Attributes.Clone()
 		}
 		if nodemap[edge.Dst.ID] == nil {
 			nodemap[edge.Dst.ID] = g.AddNode(edge.Dst.Point)
+			nodemap[edge.Dst.ID].Attributes = edge.Dst.Attributes.Clone()
 		}
-		g.AddEdge(nodemap[edge.Src.ID], nodemap[edge.Dst.ID])
+		g.AddEdge(nodemap[edge.Src.ID], nodemap[edge.Dst.ID]).Attributes = edge.Attributes.Clone()
 	}
 	return g
 }
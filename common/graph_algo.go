@@ -1,6 +1,7 @@
 package common
 
 import (
+	"container/heap"
 	"math"
 )
 
@@ -62,57 +63,109 @@ func (result ShortestPathResult) GetFullPathTo(node *Node) []*Node {
 	return append([]*Node{result.source}, result.GetPathTo(node)...)
 }
 
+// Priority queue of node (or edge) IDs used by the search routines.
+// Entries are never updated in place: callers push a new entry whenever a
+// priority decreases and skip stale entries when they are popped.
+type pqItem struct {
+	id int
+	priority float64
+}
+
+type priorityQueue []pqItem
+
+func (pq priorityQueue) Len() int {
+	return len(pq)
+}
+
+func (pq priorityQueue) Less(i, j int) bool {
+	return pq[i].priority < pq[j].priority
+}
+
+func (pq priorityQueue) Swap(i, j int) {
+	pq[i], pq[j] = pq[j], pq[i]
+}
+
+func (pq *priorityQueue) Push(x interface{}) {
+	*pq = append(*pq, x.(pqItem))
+}
+
+func (pq *priorityQueue) Pop() interface{} {
+	old := *pq
+	item := old[len(old) - 1]
+	*pq = old[:len(old) - 1]
+	return item
+}
+
+func (params ShortestPathParams) GetEdgeLength(edge *Edge) float64 {
+	if l, ok := params.EdgeLengths[edge.ID]; ok {
+		return l
+	} else {
+		return edge.Segment().Length()
+	}
+}
+
+// Convert slice-indexed search state into a ShortestPathResult.
+// backpointers should be -1 for nodes that were never reached.
+func (graph *Graph) makeShortestPathResult(src *Node, distances []float64, finalized []bool, backpointers []int) ShortestPathResult {
+	result := ShortestPathResult{
+		source: src,
+		graph: graph,
+		Distances: make(map[int]float64, len(graph.Nodes)),
+		Remaining: make(map[int]bool),
+		Backpointers: make(map[int]int),
+	}
+	for nodeID := range graph.Nodes {
+		result.Distances[nodeID] = distances[nodeID]
+		if !finalized[nodeID] {
+			result.Remaining[nodeID] = true
+		}
+		if backpointers[nodeID] != -1 {
+			result.Backpointers[nodeID] = backpointers[nodeID]
+		}
+	}
+	return result
+}
+
 func (graph *Graph) ShortestPath(src *Node, params ShortestPathParams) ShortestPathResult {
 	// use Dijkstra's algorithm
-	distances := make(map[int]float64)
-	remaining := make(map[int]bool)
-	backpointers := make(map[int]int)
-	for _, node := range graph.Nodes {
-		distances[node.ID] = math.Inf(1)
-		remaining[node.ID] = true
+	distances := make([]float64, len(graph.Nodes))
+	finalized := make([]bool, len(graph.Nodes))
+	backpointers := make([]int, len(graph.Nodes))
+	for i := range graph.Nodes {
+		distances[i] = math.Inf(1)
+		backpointers[i] = -1
+	}
+	stopNodes := make(map[int]bool)
+	for _, node := range params.StopNodes {
+		stopNodes[node.ID] = true
 	}
 
 	distances[src.ID] = 0
 	backpointers[src.ID] = src.ID
-	for len(remaining) > 0 {
-		var closestNode *Node
-		var closestDistance float64
-		for nodeID := range remaining {
-			if !math.IsInf(distances[nodeID], 1) && (closestNode == nil || distances[nodeID] < closestDistance) {
-				closestNode = graph.Nodes[nodeID]
-				closestDistance = distances[nodeID]
-			}
+	pq := &priorityQueue{{src.ID, 0}}
+	for pq.Len() > 0 {
+		item := heap.Pop(pq).(pqItem)
+		if finalized[item.id] || item.priority > distances[item.id] {
+			continue
 		}
-		if closestNode == nil {
-			break
-		}
-		delete(remaining, closestNode.ID)
-		if (params.MaxDistance != 0 && closestDistance > params.MaxDistance) || params.IsStopNode(closestNode) {
+		closestNode := graph.Nodes[item.id]
+		closestDistance := item.priority
+		finalized[closestNode.ID] = true
+		if (params.MaxDistance != 0 && closestDistance > params.MaxDistance) || stopNodes[closestNode.ID] {
 			break
 		}
 
 		for _, edge := range closestNode.Out {
-			var edgeLength float64
-			if l, ok := params.EdgeLengths[edge.ID]; ok {
-				edgeLength = l
-			} else {
-				edgeLength = edge.Segment().Length()
-			}
-			d := closestDistance + edgeLength
-			if remaining[edge.Dst.ID] && d < distances[edge.Dst.ID] {
+			d := closestDistance + params.GetEdgeLength(edge)
+			if !finalized[edge.Dst.ID] && d < distances[edge.Dst.ID] {
 				distances[edge.Dst.ID] = d
 				backpointers[edge.Dst.ID] = closestNode.ID
+				heap.Push(pq, pqItem{edge.Dst.ID, d})
 			}
 		}
 	}
 
-	return ShortestPathResult{
-		source: src,
-		graph: graph,
-		Distances: distances,
-		Remaining: remaining,
-		Backpointers: backpointers,
-	}
+	return graph.makeShortestPathResult(src, distances, finalized, backpointers)
 }
 
 type FollowParams struct {
@@ -236,53 +289,233 @@ type AstarParams struct {
 }
 
 func (graph *Graph) Astar(src *Node, dst *Node, params AstarParams) ShortestPathResult {
-	distances := make(map[int]float64)
-	remaining := make(map[int]bool)
-	backpointers := make(map[int]int)
-	scores := make(map[int]float64)
-	for _, node := range graph.Nodes {
-		distances[node.ID] = math.Inf(1)
-		remaining[node.ID] = true
-		scores[node.ID] = math.Inf(1)
+	distances := make([]float64, len(graph.Nodes))
+	finalized := make([]bool, len(graph.Nodes))
+	backpointers := make([]int, len(graph.Nodes))
+	for i := range graph.Nodes {
+		distances[i] = math.Inf(1)
+		backpointers[i] = -1
 	}
 
 	distances[src.ID] = 0
 	backpointers[src.ID] = src.ID
-	scores[src.ID] = src.Point.Distance(dst.Point)
-	for len(remaining) > 0 {
-		var closestNode *Node
-		var closestDistance float64
-		var closestScore float64
-		for nodeID := range remaining {
-			if !math.IsInf(scores[nodeID], 1) && (closestNode == nil || scores[nodeID] < closestScore) {
-				closestNode = graph.Nodes[nodeID]
-				closestDistance = distances[nodeID]
-				closestScore = scores[nodeID]
-			}
+	pq := &priorityQueue{{src.ID, src.Point.Distance(dst.Point)}}
+	for pq.Len() > 0 {
+		item := heap.Pop(pq).(pqItem)
+		if finalized[item.id] {
+			continue
 		}
-		if closestNode == nil {
-			break
+		closestNode := graph.Nodes[item.id]
+		closestDistance := distances[item.id]
+		if item.priority > closestDistance + closestNode.Point.Distance(dst.Point) {
+			continue
 		}
-		delete(remaining, closestNode.ID)
+		finalized[closestNode.ID] = true
 		if (params.MaxDistance != 0 && closestDistance > params.MaxDistance) || closestNode == dst {
 			break
 		}
 
 		for _, edge := range closestNode.Out {
 			d := closestDistance + edge.Segment().Length()
-			if remaining[edge.Dst.ID] && d < distances[edge.Dst.ID] {
+			if !finalized[edge.Dst.ID] && d < distances[edge.Dst.ID] {
 				distances[edge.Dst.ID] = d
 				backpointers[edge.Dst.ID] = closestNode.ID
-				scores[edge.Dst.ID] = d + edge.Dst.Point.Distance(dst.Point)
+				heap.Push(pq, pqItem{edge.Dst.ID, d + edge.Dst.Point.Distance(dst.Point)})
 			}
 		}
 	}
 
-	return ShortestPathResult{
-		source: src,
-		graph: graph,
-		Distances: distances,
-		Remaining: remaining,
-		Backpointers: backpointers,
+	return graph.makeShortestPathResult(src, distances, finalized, backpointers)
+}
+
+// Bidirectional Dijkstra
+
+// Find the shortest path from src to dst by searching forwards from src and backwards
+// from dst at the same time, stopping once the two searches meet.
+// Returns the full path (including src and dst) and its length, or nil and +Inf if there
+// is no path. Only EdgeLengths and MaxDistance are used from params.
+func (graph *Graph) BidirectionalShortestPath(src *Node, dst *Node, params ShortestPathParams) ([]*Node, float64) {
+	if src == dst {
+		return []*Node{src}, 0
+	}
+
+	// index 0 is the forward search from src, index 1 is the backward search from dst
+	var distances [2][]float64
+	var finalized [2][]bool
+	var backpointers [2][]int
+	var pqs [2]*priorityQueue
+	for dir, node := range []*Node{src, dst} {
+		distances[dir] = make([]float64, len(graph.Nodes))
+		finalized[dir] = make([]bool, len(graph.Nodes))
+		backpointers[dir] = make([]int, len(graph.Nodes))
+		for i := range graph.Nodes {
+			distances[dir][i] = math.Inf(1)
+			backpointers[dir][i] = -1
+		}
+		distances[dir][node.ID] = 0
+		backpointers[dir][node.ID] = node.ID
+		pqs[dir] = &priorityQueue{{node.ID, 0}}
 	}
+
+	bestDistance := math.Inf(1)
+	meetNode := -1
+	for pqs[0].Len() > 0 && pqs[1].Len() > 0 {
+		if (*pqs[0])[0].priority + (*pqs[1])[0].priority >= bestDistance {
+			break
+		}
+
+		// expand whichever search has the smaller frontier
+		dir := 0
+		if pqs[1].Len() < pqs[0].Len() {
+			dir = 1
+		}
+		item := heap.Pop(pqs[dir]).(pqItem)
+		if finalized[dir][item.id] || item.priority > distances[dir][item.id] {
+			continue
+		}
+		finalized[dir][item.id] = true
+		node := graph.Nodes[item.id]
+
+		var edges []*Edge
+		if dir == 0 {
+			edges = node.Out
+		} else {
+			edges = node.In
+		}
+		for _, edge := range edges {
+			other := edge.Dst
+			if dir == 1 {
+				other = edge.Src
+			}
+			d := item.priority + params.GetEdgeLength(edge)
+			if params.MaxDistance != 0 && d > params.MaxDistance {
+				continue
+			}
+			if !finalized[dir][other.ID] && d < distances[dir][other.ID] {
+				distances[dir][other.ID] = d
+				backpointers[dir][other.ID] = node.ID
+				heap.Push(pqs[dir], pqItem{other.ID, d})
+			}
+			if total := d + distances[1 - dir][other.ID]; total < bestDistance {
+				bestDistance = total
+				meetNode = other.ID
+			}
+		}
+	}
+
+	if meetNode == -1 || (params.MaxDistance != 0 && bestDistance > params.MaxDistance) {
+		return nil, math.Inf(1)
+	}
+
+	// walk back from the meeting node to src, then forwards to dst
+	var reverseSeq []*Node
+	for nodeID := meetNode; nodeID != src.ID; nodeID = backpointers[0][nodeID] {
+		reverseSeq = append(reverseSeq, graph.Nodes[nodeID])
+	}
+	path := []*Node{src}
+	for i := len(reverseSeq) - 1; i >= 0; i-- {
+		path = append(path, reverseSeq[i])
+	}
+	for nodeID := meetNode; nodeID != dst.ID; {
+		nodeID = backpointers[1][nodeID]
+		path = append(path, graph.Nodes[nodeID])
+	}
+	return path, bestDistance
+}
+
+// Many-to-many distances
+
+// Compute the shortest path distance from every source node to every target node.
+// matrix[i][j] is the distance from sources[i] to targets[j], or +Inf if targets[j] is
+// not reachable (or is farther than params.MaxDistance).
+// Rather than searching between each pair, we run one search per source that stops once
+// all of the targets are settled. If there are fewer targets than sources, we instead
+// run one backwards search per target.
+func (graph *Graph) DistanceMatrix(sources []*Node, targets []*Node, params ShortestPathParams) [][]float64 {
+	matrix := make([][]float64, len(sources))
+	for i := range matrix {
+		matrix[i] = make([]float64, len(targets))
+	}
+	backwards := len(targets) < len(sources)
+	roots, goals := sources, targets
+	if backwards {
+		roots, goals = targets, sources
+	}
+
+	// goal node ID -> indices in goals (the same node may be listed more than once)
+	goalIndices := make(map[int][]int)
+	for i, node := range goals {
+		goalIndices[node.ID] = append(goalIndices[node.ID], i)
+	}
+
+	// search buffers are shared across the searches, we only reset entries that were touched
+	distances := make([]float64, len(graph.Nodes))
+	finalized := make([]bool, len(graph.Nodes))
+	for i := range distances {
+		distances[i] = math.Inf(1)
+	}
+	var touched []int
+
+	for rootIdx, root := range roots {
+		row := make([]float64, len(goals))
+		for i := range row {
+			row[i] = math.Inf(1)
+		}
+		remainingGoals := len(goalIndices)
+
+		distances[root.ID] = 0
+		touched = append(touched, root.ID)
+		pq := &priorityQueue{{root.ID, 0}}
+		for pq.Len() > 0 && remainingGoals > 0 {
+			item := heap.Pop(pq).(pqItem)
+			if finalized[item.id] || item.priority > distances[item.id] {
+				continue
+			}
+			finalized[item.id] = true
+			if indices, ok := goalIndices[item.id]; ok {
+				for _, i := range indices {
+					row[i] = item.priority
+				}
+				remainingGoals--
+			}
+
+			node := graph.Nodes[item.id]
+			edges := node.Out
+			if backwards {
+				edges = node.In
+			}
+			for _, edge := range edges {
+				other := edge.Dst
+				if backwards {
+					other = edge.Src
+				}
+				d := item.priority + params.GetEdgeLength(edge)
+				if params.MaxDistance != 0 && d > params.MaxDistance {
+					continue
+				}
+				if !finalized[other.ID] && d < distances[other.ID] {
+					if math.IsInf(distances[other.ID], 1) {
+						touched = append(touched, other.ID)
+					}
+					distances[other.ID] = d
+					heap.Push(pq, pqItem{other.ID, d})
+				}
+			}
+		}
+
+		for i, d := range row {
+			if backwards {
+				matrix[i][rootIdx] = d
+			} else {
+				matrix[rootIdx][i] = d
+			}
+		}
+		for _, nodeID := range touched {
+			distances[nodeID] = math.Inf(1)
+			finalized[nodeID] = false
+		}
+		touched = touched[:0]
+	}
+
+	return matrix
 }
@@ -0,0 +1,254 @@
+package common
+
+import (
+	"math"
+	"testing"
+)
+
+// Returns a bidirectional n x n grid graph with unit spacing.
+func testGridGraph(n int) *Graph {
+	graph := &Graph{}
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			graph.AddNode(Point{float64(i), float64(j)})
+		}
+	}
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			if i + 1 < n {
+				graph.AddBidirectionalEdge(graph.Nodes[i*n + j], graph.Nodes[(i+1)*n + j])
+			}
+			if j + 1 < n {
+				graph.AddBidirectionalEdge(graph.Nodes[i*n + j], graph.Nodes[i*n + j + 1])
+			}
+		}
+	}
+	return graph
+}
+
+func TestShortestPath(t *testing.T) {
+	graph := testGridGraph(5)
+	src := graph.Nodes[0]
+	result := graph.ShortestPath(src, ShortestPathParams{})
+	for _, node := range graph.Nodes {
+		expected := node.Point.X + node.Point.Y
+		if math.Abs(result.Distances[node.ID] - expected) > 0.001 {
+			t.Fatalf("expected distance %f to %v but got %f", expected, node, result.Distances[node.ID])
+		}
+		if path := result.GetPathTo(node); len(path) != int(expected) {
+			t.Fatalf("expected path of length %d to %v but got %d", int(expected), node, len(path))
+		}
+	}
+
+	// with a stop node, farther nodes should remain unvisited
+	result = graph.ShortestPath(src, ShortestPathParams{StopNodes: []*Node{graph.Nodes[1]}})
+	if !result.Remaining[graph.Nodes[24].ID] || result.GetPathTo(graph.Nodes[24]) != nil {
+		t.Fatalf("expected search to stop before reaching far corner")
+	}
+
+	// overriding an edge length should route around it
+	edge := graph.FindEdge(graph.Nodes[0], graph.Nodes[1])
+	result = graph.ShortestPath(src, ShortestPathParams{EdgeLengths: map[int]float64{edge.ID: 100}})
+	if math.Abs(result.Distances[1] - 3) > 0.001 {
+		t.Fatalf("expected distance 3 with overridden edge length but got %f", result.Distances[1])
+	}
+}
+
+func TestAstar(t *testing.T) {
+	graph := testGridGraph(5)
+	src := graph.Nodes[0]
+	dst := graph.Nodes[24]
+	result := graph.Astar(src, dst, AstarParams{})
+	if math.Abs(result.Distances[dst.ID] - 8) > 0.001 {
+		t.Fatalf("expected distance 8 but got %f", result.Distances[dst.ID])
+	}
+	path := result.GetFullPathTo(dst)
+	if len(path) != 9 || path[0] != src || path[len(path) - 1] != dst {
+		t.Fatalf("bad path %v", path)
+	}
+}
+
+func TestBidirectionalShortestPath(t *testing.T) {
+	graph := testGridGraph(5)
+	src := graph.Nodes[2]
+	dst := graph.Nodes[21]
+	path, distance := graph.BidirectionalShortestPath(src, dst, ShortestPathParams{})
+	expected := graph.ShortestPath(src, ShortestPathParams{}).Distances[dst.ID]
+	if math.Abs(distance - expected) > 0.001 {
+		t.Fatalf("expected distance %f but got %f", expected, distance)
+	}
+	if len(path) != 6 || path[0] != src || path[len(path) - 1] != dst {
+		t.Fatalf("bad path %v", path)
+	}
+	for i := 1; i < len(path); i++ {
+		if graph.FindEdge(path[i - 1], path[i]) == nil {
+			t.Fatalf("path %v is not connected", path)
+		}
+	}
+
+	// remove connectivity via a directed graph
+	directed := &Graph{}
+	a := directed.AddNode(Point{0, 0})
+	b := directed.AddNode(Point{1, 0})
+	directed.AddEdge(a, b)
+	if path, _ := directed.BidirectionalShortestPath(b, a, ShortestPathParams{}); path != nil {
+		t.Fatalf("expected no path but got %v", path)
+	}
+}
+
+func TestDistanceMatrix(t *testing.T) {
+	graph := testGridGraph(5)
+	sources := []*Node{graph.Nodes[0], graph.Nodes[12], graph.Nodes[4]}
+	targets := []*Node{graph.Nodes[24], graph.Nodes[0]}
+	for _, pair := range [][2][]*Node{{sources, targets}, {targets, sources}} {
+		matrix := graph.DistanceMatrix(pair[0], pair[1], ShortestPathParams{})
+		for i, src := range pair[0] {
+			result := graph.ShortestPath(src, ShortestPathParams{})
+			for j, dst := range pair[1] {
+				if math.Abs(matrix[i][j] - result.Distances[dst.ID]) > 0.001 {
+					t.Fatalf("expected distance %f from %v to %v but got %f", result.Distances[dst.ID], src, dst, matrix[i][j])
+				}
+			}
+		}
+	}
+}
+
+func TestKShortestPaths(t *testing.T) {
+	// two routes from a to d: a-b-d (length 2) and a-c-d (length ~2.83), plus a-b-c-d
+	graph := &Graph{}
+	a := graph.AddNode(Point{0, 0})
+	b := graph.AddNode(Point{1, 0})
+	c := graph.AddNode(Point{1, 2})
+	d := graph.AddNode(Point{2, 0})
+	graph.AddBidirectionalEdge(a, b)
+	graph.AddBidirectionalEdge(b, d)
+	graph.AddBidirectionalEdge(a, c)
+	graph.AddBidirectionalEdge(c, d)
+	graph.AddBidirectionalEdge(b, c)
+
+	paths := graph.KShortestPaths(a, d, 10, ShortestPathParams{})
+	if len(paths) != 4 {
+		t.Fatalf("expected 4 loopless paths but got %d", len(paths))
+	}
+	if len(paths[0].Nodes) != 3 || paths[0].Nodes[1] != b || math.Abs(paths[0].Length - 2) > 0.001 {
+		t.Fatalf("bad shortest path %v (%f)", paths[0].Nodes, paths[0].Length)
+	}
+	for i := 1; i < len(paths); i++ {
+		if paths[i].Length < paths[i - 1].Length {
+			t.Fatalf("paths are not sorted by length")
+		}
+		seen := make(map[int]bool)
+		for _, node := range paths[i].Nodes {
+			if seen[node.ID] {
+				t.Fatalf("path %v has a loop", paths[i].Nodes)
+			}
+			seen[node.ID] = true
+		}
+	}
+
+	edge := graph.FindEdge(b, d)
+	paths = graph.KShortestPaths(a, d, 1, ShortestPathParams{EdgeLengths: map[int]float64{edge.ID: 100}})
+	if len(paths) != 1 || paths[0].Nodes[1] != c {
+		t.Fatalf("expected overridden edge length to be respected, got %v", paths)
+	}
+}
+
+func TestTurnShortestPath(t *testing.T) {
+	graph := testGridGraph(3)
+	src := graph.Nodes[0]
+	dst := graph.Nodes[8]
+	check := func(label string, params TurnShortestPathParams, expected float64) {
+		result := graph.TurnShortestPath(src, params)
+		if got := result.DistanceTo(dst); math.Abs(got - expected) > 0.001 {
+			t.Fatalf("%s: expected distance %f but got %f", label, expected, got)
+		}
+		path := result.GetFullPathTo(dst)
+		if path[0] != src || path[len(path) - 1] != dst {
+			t.Fatalf("%s: bad path %v", label, path)
+		}
+	}
+	turn := TURN_COST_PER_RADIAN * math.Pi / 2
+	check("no turn costs", TurnShortestPathParams{}, 4)
+	check("default turn costs", TurnShortestPathParams{TurnCost: DefaultTurnCost}, 4 + turn)
+
+	// ban the single-turn routes through the corners, forcing two turns
+	bannedTurns := map[[2]int]bool{
+		{graph.FindEdge(graph.Nodes[3], graph.Nodes[6]).ID, graph.FindEdge(graph.Nodes[6], graph.Nodes[7]).ID}: true,
+		{graph.FindEdge(graph.Nodes[1], graph.Nodes[2]).ID, graph.FindEdge(graph.Nodes[2], graph.Nodes[5]).ID}: true,
+	}
+	check("banned turns", TurnShortestPathParams{TurnCost: DefaultTurnCost, BannedTurns: bannedTurns}, 4 + 2 * turn)
+}
+
+func TestIsochrones(t *testing.T) {
+	graph := testGridGraph(5)
+	isochrones, err := graph.Isochrones(IsochroneParams{
+		SourceNodes: []*Node{graph.Nodes[12]},
+		Distances: []float64{1, 1.5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// within distance 1 of the center, the four outgoing edges are fully traversed
+	if len(isochrones[0].Edges) != 4 || len(isochrones[0].PartialEdges) != 0 {
+		t.Fatalf("expected 4 full edges but got %d full and %d partial", len(isochrones[0].Edges), len(isochrones[0].PartialEdges))
+	}
+	// at 1.5, the 16 edges leaving those neighbors are half traversed
+	if len(isochrones[1].Edges) != 4 || len(isochrones[1].PartialEdges) != 16 {
+		t.Fatalf("expected 4 full and 16 partial edges but got %d full and %d partial", len(isochrones[1].Edges), len(isochrones[1].PartialEdges))
+	}
+	for _, pe := range isochrones[1].PartialEdges {
+		if math.Abs(pe.End - 0.5) > 0.001 {
+			t.Fatalf("expected partial edge to be clipped at 0.5 but got %f", pe.End)
+		}
+	}
+	if !isochrones[1].Polygon.Contains(Point{2.2, 2.1}) || isochrones[1].Polygon.Contains(Point{4, 4}) {
+		t.Fatalf("bad isochrone polygon %v", isochrones[1].Polygon)
+	}
+
+	// starting in the middle of an edge
+	edge := graph.FindEdge(graph.Nodes[12], graph.Nodes[13])
+	isochrones, err = graph.Isochrones(IsochroneParams{
+		SourcePos: EdgePos{edge, 0.5},
+		Distances: []float64{0.25},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(isochrones[0].PartialEdges) != 1 || isochrones[0].PartialEdges[0].Start != 0.5 || isochrones[0].PartialEdges[0].End != 0.75 {
+		t.Fatalf("expected [0.5, 0.75] on source edge but got %v", isochrones[0].PartialEdges)
+	}
+
+	// going around a one-way loop back onto the source edge
+	loop := &Graph{}
+	var nodes []*Node
+	for _, p := range []Point{{0, 0}, {1, 0}, {1, 1}, {0, 1}} {
+		nodes = append(nodes, loop.AddNode(p))
+	}
+	for i := range nodes {
+		loop.AddEdge(nodes[i], nodes[(i + 1) % len(nodes)])
+	}
+	isochrones, err = loop.Isochrones(IsochroneParams{
+		SourcePos: EdgePos{loop.Edges[0], 0.5},
+		Distances: []float64{3.8, 4.2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(isochrones[0].Edges) != 3 || len(isochrones[0].PartialEdges) != 2 {
+		t.Fatalf("expected 3 full and 2 partial edges but got %d full and %d partial", len(isochrones[0].Edges), len(isochrones[0].PartialEdges))
+	}
+	if len(isochrones[1].Edges) != 4 || len(isochrones[1].PartialEdges) != 0 {
+		t.Fatalf("expected 4 full edges but got %d full and %d partial", len(isochrones[1].Edges), len(isochrones[1].PartialEdges))
+	}
+
+	// the source must be specified exactly once
+	if _, err := graph.Isochrones(IsochroneParams{Distances: []float64{1}}); err == nil {
+		t.Fatalf("expected error without a source")
+	}
+	if _, err := graph.Isochrones(IsochroneParams{SourceNodes: []*Node{graph.Nodes[12]}, SourcePos: EdgePos{edge, 0.5}, Distances: []float64{1}}); err == nil {
+		t.Fatalf("expected error with two sources")
+	}
+	if _, err := graph.Isochrones(IsochroneParams{SourcePos: EdgePos{edge, 2}, Distances: []float64{1}}); err == nil {
+		t.Fatalf("expected error with a position past the end of the edge")
+	}
+}
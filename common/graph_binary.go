@@ -0,0 +1,257 @@
+package common
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// Binary graph format:
+//   magic (8 bytes), version (uint32), flags (uint32)
+//   number of nodes (uint64), then X and Y of each node (float64)
+//   number of edges (uint64), then source and destination node IDs of each edge (uint32)
+//   if GRAPH_BINARY_ATTRIBUTES is set: number of nodes with attributes (uint64), then the
+//   node ID (uint32) and attributes of each; and the same for edges
+// Attributes are encoded as the number of tags (uint32), each tag as a key and value
+// string, then the number of values (uint32), each value as a key string and a float64.
+// Strings are a length (uint32) followed by the bytes. All numbers are little-endian.
+const GRAPH_BINARY_MAGIC = "GMIGRAPH"
+const GRAPH_BINARY_VERSION = 1
+const GRAPH_BINARY_ATTRIBUTES = 1
+
+// Longest string that ReadBinaryGraph accepts, so that a corrupted length prefix
+// returns an error instead of allocating a huge buffer.
+const GRAPH_BINARY_MAX_STRING = 1 << 20
+
+// Graph.Write uses the binary format for filenames with this extension.
+const GRAPH_BINARY_EXT = ".bgraph"
+
+type binaryWriter struct {
+	w *bufio.Writer
+	buf [8]byte
+	err error
+}
+
+func (bw *binaryWriter) write(b []byte) {
+	if bw.err == nil {
+		_, bw.err = bw.w.Write(b)
+	}
+}
+
+func (bw *binaryWriter) uint32(x uint32) {
+	binary.LittleEndian.PutUint32(bw.buf[:4], x)
+	bw.write(bw.buf[:4])
+}
+
+func (bw *binaryWriter) uint64(x uint64) {
+	binary.LittleEndian.PutUint64(bw.buf[:], x)
+	bw.write(bw.buf[:])
+}
+
+func (bw *binaryWriter) float64(x float64) {
+	bw.uint64(math.Float64bits(x))
+}
+
+func (bw *binaryWriter) string(s string) {
+	bw.uint32(uint32(len(s)))
+	bw.write([]byte(s))
+}
+
+func (bw *binaryWriter) attributes(attrs Attributes) {
+	bw.uint32(uint32(len(attrs.Tags)))
+	for k, val := range attrs.Tags {
+		bw.string(k)
+		bw.string(val)
+	}
+	bw.uint32(uint32(len(attrs.Values)))
+	for k, val := range attrs.Values {
+		bw.string(k)
+		bw.float64(val)
+	}
+}
+
+type binaryReader struct {
+	r io.Reader
+	buf [8]byte
+	err error
+}
+
+func (br *binaryReader) read(b []byte) {
+	if br.err == nil {
+		_, br.err = io.ReadFull(br.r, b)
+	}
+}
+
+func (br *binaryReader) uint32() uint32 {
+	br.read(br.buf[:4])
+	return binary.LittleEndian.Uint32(br.buf[:4])
+}
+
+func (br *binaryReader) uint64() uint64 {
+	br.read(br.buf[:])
+	return binary.LittleEndian.Uint64(br.buf[:])
+}
+
+func (br *binaryReader) float64() float64 {
+	return math.Float64frombits(br.uint64())
+}
+
+func (br *binaryReader) string() string {
+	n := br.uint32()
+	if br.err != nil {
+		return ""
+	} else if n > GRAPH_BINARY_MAX_STRING {
+		br.err = fmt.Errorf("string length %d exceeds maximum of %d", n, GRAPH_BINARY_MAX_STRING)
+		return ""
+	}
+	b := make([]byte, n)
+	br.read(b)
+	return string(b)
+}
+
+func (br *binaryReader) attributes() Attributes {
+	var attrs Attributes
+	numTags := br.uint32()
+	for i := uint32(0); i < numTags && br.err == nil; i++ {
+		k := br.string()
+		attrs.SetTag(k, br.string())
+	}
+	numValues := br.uint32()
+	for i := uint32(0); i < numValues && br.err == nil; i++ {
+		k := br.string()
+		attrs.SetValue(k, br.float64())
+	}
+	return attrs
+}
+
+// Write the graph in the binary format.
+// Attributes are included if any node or edge has attributes.
+func (graph *Graph) WriteBinaryTo(w io.Writer) error {
+	bw := &binaryWriter{w: bufio.NewWriter(w)}
+	attrs := graph.getAttributes()
+	var flags uint32
+	if len(attrs.Nodes) > 0 || len(attrs.Edges) > 0 {
+		flags |= GRAPH_BINARY_ATTRIBUTES
+	}
+	bw.write([]byte(GRAPH_BINARY_MAGIC))
+	bw.uint32(GRAPH_BINARY_VERSION)
+	bw.uint32(flags)
+
+	bw.uint64(uint64(len(graph.Nodes)))
+	for _, node := range graph.Nodes {
+		bw.float64(node.Point.X)
+		bw.float64(node.Point.Y)
+	}
+	bw.uint64(uint64(len(graph.Edges)))
+	for _, edge := range graph.Edges {
+		bw.uint32(uint32(edge.Src.ID))
+		bw.uint32(uint32(edge.Dst.ID))
+	}
+
+	if flags & GRAPH_BINARY_ATTRIBUTES != 0 {
+		bw.uint64(uint64(len(attrs.Nodes)))
+		for _, node := range graph.Nodes {
+			if !node.Attributes.IsEmpty() {
+				bw.uint32(uint32(node.ID))
+				bw.attributes(node.Attributes)
+			}
+		}
+		bw.uint64(uint64(len(attrs.Edges)))
+		for _, edge := range graph.Edges {
+			if !edge.Attributes.IsEmpty() {
+				bw.uint32(uint32(edge.ID))
+				bw.attributes(edge.Attributes)
+			}
+		}
+	}
+
+	if bw.err != nil {
+		return bw.err
+	}
+	return bw.w.Flush()
+}
+
+// Write the graph to a file in the binary format.
+// Like Write, this deletes any existing fname + ".attrs", since ReadGraph would
+// otherwise attach its attributes to the graph.
+func (graph *Graph) WriteBinary(fname string) error {
+	if err := writeFile(fname, graph.WriteBinaryTo); err != nil {
+		return err
+	}
+	// the attributes are in the file, so remove any stale sidecar from Write
+	if err := os.Remove(attributesFname(fname)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Read a graph in the binary format from a stream.
+// The reader is consumed only up to the end of the graph, so it should be buffered
+// (e.g. with bufio.NewReader) for speed.
+func ReadBinaryGraph(r io.Reader) (*Graph, error) {
+	br := &binaryReader{r: r}
+	magic := make([]byte, len(GRAPH_BINARY_MAGIC))
+	br.read(magic)
+	if br.err != nil {
+		return nil, fmt.Errorf("error reading binary graph header: %v", br.err)
+	} else if string(magic) != GRAPH_BINARY_MAGIC {
+		return nil, fmt.Errorf("not a binary graph")
+	}
+	version := br.uint32()
+	flags := br.uint32()
+	if br.err != nil {
+		return nil, fmt.Errorf("error reading binary graph header: %v", br.err)
+	} else if version != GRAPH_BINARY_VERSION {
+		return nil, fmt.Errorf("unsupported binary graph version %d", version)
+	}
+
+	graph := &Graph{}
+	numNodes := br.uint64()
+	for i := uint64(0); i < numNodes && br.err == nil; i++ {
+		x := br.float64()
+		y := br.float64()
+		graph.AddNode(Point{x, y})
+	}
+	numEdges := br.uint64()
+	for i := uint64(0); i < numEdges && br.err == nil; i++ {
+		src := int(br.uint32())
+		dst := int(br.uint32())
+		if br.err != nil {
+			break
+		} else if src >= len(graph.Nodes) || dst >= len(graph.Nodes) {
+			return nil, fmt.Errorf("edge %d refers to missing node", i)
+		}
+		graph.AddEdge(graph.Nodes[src], graph.Nodes[dst])
+	}
+
+	if flags & GRAPH_BINARY_ATTRIBUTES != 0 {
+		numNodeAttrs := br.uint64()
+		for i := uint64(0); i < numNodeAttrs && br.err == nil; i++ {
+			id := int(br.uint32())
+			attrs := br.attributes()
+			if br.err == nil && id >= len(graph.Nodes) {
+				return nil, fmt.Errorf("attributes refer to missing node %d", id)
+			} else if br.err == nil {
+				graph.Nodes[id].Attributes = attrs
+			}
+		}
+		numEdgeAttrs := br.uint64()
+		for i := uint64(0); i < numEdgeAttrs && br.err == nil; i++ {
+			id := int(br.uint32())
+			attrs := br.attributes()
+			if br.err == nil && id >= len(graph.Edges) {
+				return nil, fmt.Errorf("attributes refer to missing edge %d", id)
+			} else if br.err == nil {
+				graph.Edges[id].Attributes = attrs
+			}
+		}
+	}
+
+	if br.err != nil {
+		return nil, fmt.Errorf("error reading binary graph: %v", br.err)
+	}
+	return graph, nil
+}
@@ -0,0 +1,423 @@
+package common
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+)
+
+// Contraction hierarchies (Geisberger et al., 2008) for answering many shortest path
+// queries on a static graph.
+// Nodes are contracted one at a time in order of importance; whenever removing a node
+// would change the distance between two of its remaining neighbors, a shortcut arc is
+// added between them. Queries then run a bidirectional Dijkstra that only follows arcs
+// towards higher ranked nodes, which settles very few nodes.
+
+// maximum number of nodes to settle during each witness search while contracting
+const CH_WITNESS_SETTLE_LIMIT = 500
+
+// An arc in the hierarchy: either an original graph edge or a shortcut.
+type CHArc struct {
+	Src int `json:"s"`
+	Dst int `json:"d"`
+	Length float64 `json:"l"`
+
+	// ID of the original graph edge, or -1 if this is a shortcut.
+	EdgeID int `json:"e"`
+
+	// For shortcuts, the arcs (Src -> middle node, middle node -> Dst) that it replaces.
+	Children [2]int `json:"c"`
+}
+
+type ContractionHierarchy struct {
+	graph *Graph
+
+	// used to verify that a hierarchy read from disk matches the graph
+	NumNodes int `json:"num_nodes"`
+	NumEdges int `json:"num_edges"`
+
+	// node ID -> position in the contraction order
+	Ranks []int `json:"ranks"`
+
+	Arcs []CHArc `json:"arcs"`
+
+	// upOut[v] lists arcs v -> w where w is ranked higher than v
+	// upIn[v] lists arcs u -> v where u is ranked higher than v
+	upOut [][]int
+	upIn [][]int
+}
+
+// Build a contraction hierarchy over the graph.
+// Only params.EdgeLengths is used; the overridden lengths are baked into the hierarchy.
+func (graph *Graph) ContractionHierarchy(params ShortestPathParams) *ContractionHierarchy {
+	n := len(graph.Nodes)
+	ch := &ContractionHierarchy{
+		graph: graph,
+		NumNodes: n,
+		NumEdges: len(graph.Edges),
+		Ranks: make([]int, n),
+	}
+
+	// adjacency among nodes that are not yet contracted, mapping neighbor ID -> arc index
+	outArcs := make([]map[int]int, n)
+	inArcs := make([]map[int]int, n)
+	for i := range graph.Nodes {
+		outArcs[i] = make(map[int]int)
+		inArcs[i] = make(map[int]int)
+	}
+
+	// Add an arc, or replace the existing arc between the same nodes if the new one is shorter.
+	// An arc between two uncontracted nodes is never the child of a shortcut, so it is safe
+	// to replace it in place.
+	addArc := func(arc CHArc) {
+		if idx, ok := outArcs[arc.Src][arc.Dst]; ok {
+			if arc.Length < ch.Arcs[idx].Length {
+				ch.Arcs[idx] = arc
+			}
+			return
+		}
+		ch.Arcs = append(ch.Arcs, arc)
+		outArcs[arc.Src][arc.Dst] = len(ch.Arcs) - 1
+		inArcs[arc.Dst][arc.Src] = len(ch.Arcs) - 1
+	}
+
+	for _, edge := range graph.Edges {
+		if edge.Src == edge.Dst {
+			continue
+		}
+		addArc(CHArc{
+			Src: edge.Src.ID,
+			Dst: edge.Dst.ID,
+			Length: params.GetEdgeLength(edge),
+			EdgeID: edge.ID,
+			Children: [2]int{-1, -1},
+		})
+	}
+
+	// Returns tentative distances from src to nodes within maxDistance, avoiding the node
+	// that is being contracted. The distances may be overestimates if the settle limit is
+	// hit, in which case we just add a few unnecessary shortcuts.
+	witnessSearch := func(src int, avoid int, maxDistance float64) map[int]float64 {
+		distances := map[int]float64{src: 0}
+		settled := make(map[int]bool)
+		pq := &priorityQueue{{src, 0}}
+		for pq.Len() > 0 && len(settled) < CH_WITNESS_SETTLE_LIMIT {
+			item := heap.Pop(pq).(pqItem)
+			if settled[item.id] || item.priority > distances[item.id] {
+				continue
+			} else if item.priority > maxDistance {
+				break
+			}
+			settled[item.id] = true
+			for other, arcIdx := range outArcs[item.id] {
+				if other == avoid {
+					continue
+				}
+				d := item.priority + ch.Arcs[arcIdx].Length
+				if cur, ok := distances[other]; !ok || d < cur {
+					distances[other] = d
+					heap.Push(pq, pqItem{other, d})
+				}
+			}
+		}
+		return distances
+	}
+
+	// Returns the shortcuts needed to contract v.
+	findShortcuts := func(v int) []CHArc {
+		var shortcuts []CHArc
+		for u, inIdx := range inArcs[v] {
+			var maxDistance float64 = -1
+			for w, outIdx := range outArcs[v] {
+				if w != u {
+					maxDistance = math.Max(maxDistance, ch.Arcs[inIdx].Length + ch.Arcs[outIdx].Length)
+				}
+			}
+			if maxDistance < 0 {
+				continue
+			}
+			distances := witnessSearch(u, v, maxDistance)
+			for w, outIdx := range outArcs[v] {
+				if w == u {
+					continue
+				}
+				length := ch.Arcs[inIdx].Length + ch.Arcs[outIdx].Length
+				if d, ok := distances[w]; ok && d <= length {
+					continue
+				}
+				shortcuts = append(shortcuts, CHArc{
+					Src: u,
+					Dst: w,
+					Length: length,
+					EdgeID: -1,
+					Children: [2]int{inIdx, outIdx},
+				})
+			}
+		}
+		return shortcuts
+	}
+
+	// importance is the edge difference plus the number of contracted neighbors, which
+	// spreads contraction uniformly over the graph
+	contractedNeighbors := make([]int, n)
+	importance := func(v int) float64 {
+		return float64(len(findShortcuts(v)) - len(inArcs[v]) - len(outArcs[v]) + contractedNeighbors[v])
+	}
+
+	pq := &priorityQueue{}
+	for v := range graph.Nodes {
+		heap.Push(pq, pqItem{v, importance(v)})
+	}
+	rank := 0
+	for pq.Len() > 0 {
+		// lazy updates: recompute the importance and re-queue if it is no longer the minimum
+		item := heap.Pop(pq).(pqItem)
+		v := item.id
+		if priority := importance(v); pq.Len() > 0 && priority > (*pq)[0].priority {
+			heap.Push(pq, pqItem{v, priority})
+			continue
+		}
+
+		for _, shortcut := range findShortcuts(v) {
+			addArc(shortcut)
+		}
+		for u := range inArcs[v] {
+			delete(outArcs[u], v)
+			contractedNeighbors[u]++
+		}
+		for w := range outArcs[v] {
+			delete(inArcs[w], v)
+			contractedNeighbors[w]++
+		}
+		ch.Ranks[v] = rank
+		rank++
+	}
+
+	ch.buildUpwardGraph()
+	return ch
+}
+
+func (ch *ContractionHierarchy) buildUpwardGraph() {
+	ch.upOut = make([][]int, ch.NumNodes)
+	ch.upIn = make([][]int, ch.NumNodes)
+	for arcIdx, arc := range ch.Arcs {
+		if ch.Ranks[arc.Src] < ch.Ranks[arc.Dst] {
+			ch.upOut[arc.Src] = append(ch.upOut[arc.Src], arcIdx)
+		} else {
+			ch.upIn[arc.Dst] = append(ch.upIn[arc.Dst], arcIdx)
+		}
+	}
+}
+
+func (ch *ContractionHierarchy) Write(fname string) error {
+	bytes, err := json.Marshal(ch)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fname, bytes, 0644)
+}
+
+// Read a hierarchy written by ContractionHierarchy.Write.
+// graph must be the same graph that the hierarchy was built from.
+func ReadContractionHierarchy(fname string, graph *Graph) (*ContractionHierarchy, error) {
+	bytes, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	ch := &ContractionHierarchy{graph: graph}
+	if err := json.Unmarshal(bytes, ch); err != nil {
+		return nil, err
+	}
+	if ch.NumNodes != len(graph.Nodes) || ch.NumEdges != len(graph.Edges) {
+		return nil, fmt.Errorf("hierarchy was built for %d nodes and %d edges but graph has %d nodes and %d edges", ch.NumNodes, ch.NumEdges, len(graph.Nodes), len(graph.Edges))
+	} else if len(ch.Ranks) != ch.NumNodes {
+		return nil, fmt.Errorf("expected %d ranks but got %d", ch.NumNodes, len(ch.Ranks))
+	}
+	if err := ch.validate(); err != nil {
+		return nil, err
+	}
+	ch.buildUpwardGraph()
+	return ch, nil
+}
+
+// Check that a hierarchy read from disk is consistent with ch.graph, so that queries
+// cannot index out of range or recurse forever while unpacking shortcuts.
+func (ch *ContractionHierarchy) validate() error {
+	seenRanks := make([]bool, ch.NumNodes)
+	for nodeID, rank := range ch.Ranks {
+		if rank < 0 || rank >= ch.NumNodes || seenRanks[rank] {
+			return fmt.Errorf("node %d has invalid rank %d", nodeID, rank)
+		}
+		seenRanks[rank] = true
+	}
+	for arcIdx, arc := range ch.Arcs {
+		if arc.Src < 0 || arc.Src >= ch.NumNodes || arc.Dst < 0 || arc.Dst >= ch.NumNodes {
+			return fmt.Errorf("arc %d -> %d references unknown node", arc.Src, arc.Dst)
+		}
+		if arc.EdgeID >= 0 {
+			if arc.EdgeID >= ch.NumEdges {
+				return fmt.Errorf("arc %d references unknown edge %d", arcIdx, arc.EdgeID)
+			}
+			edge := ch.graph.Edges[arc.EdgeID]
+			if edge.Src.ID != arc.Src || edge.Dst.ID != arc.Dst {
+				return fmt.Errorf("arc %d does not match edge %d", arcIdx, arc.EdgeID)
+			}
+			continue
+		} else if arc.EdgeID != -1 {
+			return fmt.Errorf("arc %d has invalid edge ID %d", arcIdx, arc.EdgeID)
+		}
+		for _, child := range arc.Children {
+			if child < 0 || child >= len(ch.Arcs) {
+				return fmt.Errorf("shortcut %d references unknown arc %d", arcIdx, child)
+			}
+		}
+		first, second := ch.Arcs[arc.Children[0]], ch.Arcs[arc.Children[1]]
+		if first.Src != arc.Src || second.Dst != arc.Dst || first.Dst != second.Src {
+			return fmt.Errorf("children of shortcut %d do not form a path", arcIdx)
+		}
+		// the middle node is contracted before both endpoints, which guarantees that
+		// unpacking terminates
+		middle := ch.Ranks[first.Dst]
+		if middle >= ch.Ranks[arc.Src] || middle >= ch.Ranks[arc.Dst] {
+			return fmt.Errorf("shortcut %d bypasses a node that is ranked higher than its endpoints", arcIdx)
+		}
+	}
+	return nil
+}
+
+// A query against a ContractionHierarchy.
+// Search buffers are reused across queries, so a CHQuery must not be used by multiple
+// goroutines at once; create one query per goroutine instead.
+type CHQuery struct {
+	ch *ContractionHierarchy
+
+	// index 0 is the forward search, index 1 is the backward search
+	distances [2][]float64
+	backArcs [2][]int
+	touched []int
+}
+
+func (ch *ContractionHierarchy) NewQuery() *CHQuery {
+	q := &CHQuery{ch: ch}
+	for dir := 0; dir < 2; dir++ {
+		q.distances[dir] = make([]float64, ch.NumNodes)
+		q.backArcs[dir] = make([]int, ch.NumNodes)
+		for i := range q.distances[dir] {
+			q.distances[dir][i] = math.Inf(1)
+			q.backArcs[dir][i] = -1
+		}
+	}
+	return q
+}
+
+func (q *CHQuery) reset() {
+	for _, nodeID := range q.touched {
+		for dir := 0; dir < 2; dir++ {
+			q.distances[dir][nodeID] = math.Inf(1)
+			q.backArcs[dir][nodeID] = -1
+		}
+	}
+	q.touched = q.touched[:0]
+}
+
+// Returns the node where the forward and backward searches meet on a shortest path, and
+// the path length. The meeting node is -1 if dst is not reachable.
+func (q *CHQuery) search(src *Node, dst *Node) (int, float64) {
+	q.reset()
+	q.distances[0][src.ID] = 0
+	q.distances[1][dst.ID] = 0
+	q.touched = append(q.touched, src.ID, dst.ID)
+	pqs := [2]*priorityQueue{{{src.ID, 0}}, {{dst.ID, 0}}}
+
+	bestDistance := math.Inf(1)
+	meetNode := -1
+	for pqs[0].Len() > 0 || pqs[1].Len() > 0 {
+		for dir := 0; dir < 2; dir++ {
+			if pqs[dir].Len() == 0 {
+				continue
+			}
+			item := heap.Pop(pqs[dir]).(pqItem)
+			if item.priority > q.distances[dir][item.id] {
+				continue
+			} else if item.priority >= bestDistance {
+				// nothing left in this direction can improve the path
+				*pqs[dir] = (*pqs[dir])[:0]
+				continue
+			}
+			if total := item.priority + q.distances[1 - dir][item.id]; total < bestDistance {
+				bestDistance = total
+				meetNode = item.id
+			}
+
+			var arcs []int
+			if dir == 0 {
+				arcs = q.ch.upOut[item.id]
+			} else {
+				arcs = q.ch.upIn[item.id]
+			}
+			for _, arcIdx := range arcs {
+				arc := q.ch.Arcs[arcIdx]
+				other := arc.Dst
+				if dir == 1 {
+					other = arc.Src
+				}
+				d := item.priority + arc.Length
+				if d < q.distances[dir][other] {
+					if math.IsInf(q.distances[0][other], 1) && math.IsInf(q.distances[1][other], 1) {
+						q.touched = append(q.touched, other)
+					}
+					q.distances[dir][other] = d
+					q.backArcs[dir][other] = arcIdx
+					heap.Push(pqs[dir], pqItem{other, d})
+				}
+			}
+		}
+	}
+	return meetNode, bestDistance
+}
+
+// Returns the shortest path distance from src to dst, or +Inf if dst is not reachable.
+func (q *CHQuery) Distance(src *Node, dst *Node) float64 {
+	_, distance := q.search(src, dst)
+	return distance
+}
+
+// Returns the shortest path from src to dst, excluding src (like ShortestPathResult.GetPathTo).
+// Returns nil if dst is not reachable.
+func (q *CHQuery) GetPath(src *Node, dst *Node) []*Node {
+	meetNode, _ := q.search(src, dst)
+	if meetNode == -1 {
+		return nil
+	}
+
+	// collect the arcs along the path in order
+	var reverseArcs []int
+	for nodeID := meetNode; nodeID != src.ID; nodeID = q.ch.Arcs[q.backArcs[0][nodeID]].Src {
+		reverseArcs = append(reverseArcs, q.backArcs[0][nodeID])
+	}
+	var arcs []int
+	for i := len(reverseArcs) - 1; i >= 0; i-- {
+		arcs = append(arcs, reverseArcs[i])
+	}
+	for nodeID := meetNode; nodeID != dst.ID; nodeID = q.ch.Arcs[q.backArcs[1][nodeID]].Dst {
+		arcs = append(arcs, q.backArcs[1][nodeID])
+	}
+
+	path := []*Node{}
+	for _, arcIdx := range arcs {
+		path = q.ch.unpackArc(arcIdx, path)
+	}
+	return path
+}
+
+// Appends the nodes along an arc (excluding its source) to path.
+func (ch *ContractionHierarchy) unpackArc(arcIdx int, path []*Node) []*Node {
+	arc := ch.Arcs[arcIdx]
+	if arc.EdgeID >= 0 {
+		return append(path, ch.graph.Nodes[arc.Dst])
+	}
+	path = ch.unpackArc(arc.Children[0], path)
+	return ch.unpackArc(arc.Children[1], path)
+}
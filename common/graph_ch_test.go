@@ -0,0 +1,119 @@
+package common
+
+import (
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestContractionHierarchy(t *testing.T) {
+	graph := testGridGraph(8)
+	// vary edge lengths (and make some edges very long) so that shortcuts are needed
+	rng := rand.New(rand.NewSource(0))
+	params := ShortestPathParams{EdgeLengths: make(map[int]float64)}
+	for _, edge := range graph.Edges {
+		params.EdgeLengths[edge.ID] = 1 + 4 * rng.Float64()
+	}
+	for i := 0; i < 10; i++ {
+		edge := graph.Edges[rng.Intn(len(graph.Edges))]
+		params.EdgeLengths[edge.ID] = 1000
+	}
+
+	dir, err := ioutil.TempDir("", "ch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "graph.ch")
+	if err := graph.ContractionHierarchy(params).Write(fname); err != nil {
+		t.Fatal(err)
+	}
+	ch, err := ReadContractionHierarchy(fname, graph)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := ch.NewQuery()
+	for _, src := range graph.Nodes {
+		result := graph.ShortestPath(src, params)
+		for _, dst := range graph.Nodes {
+			expected := result.Distances[dst.ID]
+			if got := q.Distance(src, dst); math.Abs(got - expected) > 0.001 {
+				t.Fatalf("expected distance %f from %v to %v but got %f", expected, src, dst, got)
+			}
+			path := q.GetPath(src, dst)
+			if len(path) == 0 {
+				if src != dst {
+					t.Fatalf("expected path from %v to %v", src, dst)
+				}
+				continue
+			}
+			var length float64
+			prev := src
+			for _, node := range path {
+				edge := graph.FindEdge(prev, node)
+				if edge == nil {
+					t.Fatalf("path from %v to %v is not connected", src, dst)
+				}
+				length += params.GetEdgeLength(edge)
+				prev = node
+			}
+			if prev != dst || math.Abs(length - expected) > 0.001 {
+				t.Fatalf("bad path from %v to %v: length %f, expected %f", src, dst, length, expected)
+			}
+		}
+	}
+}
+
+func TestReadContractionHierarchyInvalid(t *testing.T) {
+	graph := testGridGraph(4)
+	dir, err := ioutil.TempDir("", "ch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "graph.ch")
+
+	ch := graph.ContractionHierarchy(ShortestPathParams{})
+	shortcut := -1
+	for i, arc := range ch.Arcs {
+		if arc.EdgeID == -1 {
+			shortcut = i
+			break
+		}
+	}
+	if shortcut == -1 {
+		t.Fatalf("expected the hierarchy to have a shortcut")
+	}
+
+	corruptions := map[string]func(ch *ContractionHierarchy){
+		"ranks length": func(ch *ContractionHierarchy) { ch.Ranks = ch.Ranks[1:] },
+		"duplicate rank": func(ch *ContractionHierarchy) { ch.Ranks[0] = ch.Ranks[1] },
+		"edge ID": func(ch *ContractionHierarchy) { ch.Arcs[0].EdgeID = len(graph.Edges) },
+		"child index": func(ch *ContractionHierarchy) { ch.Arcs[shortcut].Children[0] = len(ch.Arcs) },
+		"self child": func(ch *ContractionHierarchy) { ch.Arcs[shortcut].Children[0] = shortcut },
+	}
+	for name, corrupt := range corruptions {
+		ch := graph.ContractionHierarchy(ShortestPathParams{})
+		corrupt(ch)
+		if err := ch.Write(fname); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadContractionHierarchy(fname, graph); err == nil {
+			t.Fatalf("expected error for invalid %s", name)
+		}
+	}
+
+	// a hierarchy for a different graph of the same size is rejected
+	if err := ch.Write(fname); err != nil {
+		t.Fatal(err)
+	}
+	other := testGridGraph(4)
+	other.Edges[0].Src, other.Edges[0].Dst = other.Edges[0].Dst, other.Edges[0].Src
+	if _, err := ReadContractionHierarchy(fname, other); err == nil {
+		t.Fatalf("expected error for hierarchy of a different graph")
+	}
+}
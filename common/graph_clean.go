@@ -0,0 +1,216 @@
+package common
+
+type CleanOptions struct {
+	// Remove edges from a node to itself.
+	RemoveSelfLoops bool
+
+	// Contract edges whose endpoints are at the same location.
+	RemoveZeroLength bool
+
+	// Merge nodes closer than this distance into one node at their centroid.
+	// Clusters are not chained: each node is only merged with a cluster if it is within
+	// the distance of the node that started the cluster. Edges between merged nodes are
+	// removed. Zero to disable.
+	MergeTolerance float64
+
+	// Remove dead-end chains shorter than this length that hang off a junction.
+	// Zero to disable.
+	SpurLength float64
+}
+
+type CleanReport struct {
+	// parallel edges between the same pair of nodes, including those created when nodes
+	// are merged (always removed, since AddEdge does not allow them)
+	DuplicateEdges int
+
+	SelfLoops int
+	ZeroLengthEdges int
+
+	// nodes removed by merging (including endpoints of zero-length edges)
+	MergedNodes int
+
+	// edges whose endpoints were merged into the same node
+	CollapsedEdges int
+
+	Spurs int
+	SpurEdges int
+}
+
+// Returns a cleaned copy of the graph, along with a report of what changed.
+// The passes run in order: zero-length edges and nearby nodes are merged, self-loops
+// and duplicate edges are removed, and finally short dead-end spurs are pruned. Each
+// pass except duplicate edge removal only runs if it is enabled in the options.
+// Nodes that are not removed by any pass are kept even if they have no edges.
+// Merged nodes keep the attributes of the first node in their cluster.
+func (graph *Graph) Clean(options CleanOptions) (*Graph, CleanReport) {
+	var report CleanReport
+
+	// union-find over nodes that should be merged
+	parents := make([]int, len(graph.Nodes))
+	for i := range parents {
+		parents[i] = i
+	}
+	var find func(id int) int
+	find = func(id int) int {
+		if parents[id] != id {
+			parents[id] = find(parents[id])
+		}
+		return parents[id]
+	}
+	union := func(a int, b int) {
+		a, b = find(a), find(b)
+		if a != b {
+			parents[b] = a
+		}
+	}
+
+	if options.RemoveZeroLength {
+		for _, edge := range graph.Edges {
+			if edge.Src != edge.Dst && edge.Segment().Length() == 0 {
+				report.ZeroLengthEdges++
+				union(edge.Src.ID, edge.Dst.ID)
+			}
+		}
+	}
+	if options.MergeTolerance > 0 {
+		idx := NewGridIndex(options.MergeTolerance)
+		for _, node := range graph.Nodes {
+			idx.Insert(node.ID, node.Point.Rectangle())
+		}
+		// each node that is not yet in a cluster starts one with the nearby nodes that
+		// are also not in a cluster
+		clustered := make([]bool, len(graph.Nodes))
+		for _, node := range graph.Nodes {
+			if clustered[node.ID] {
+				continue
+			}
+			clustered[node.ID] = true
+			for _, otherID := range idx.Search(node.Point.RectangleTol(options.MergeTolerance)) {
+				if !clustered[otherID] && node.Point.Distance(graph.Nodes[otherID].Point) < options.MergeTolerance {
+					clustered[otherID] = true
+					union(node.ID, otherID)
+				}
+			}
+		}
+	}
+
+	// create one node per cluster at the centroid of its members
+	clusterSums := make(map[int]Point)
+	clusterCounts := make(map[int]int)
+	for _, node := range graph.Nodes {
+		root := find(node.ID)
+		clusterSums[root] = clusterSums[root].Add(node.Point)
+		clusterCounts[root]++
+	}
+	ngraph := &Graph{}
+	nodeMap := make(map[int]*Node)
+	for _, node := range graph.Nodes {
+		root := find(node.ID)
+		if nodeMap[root] == nil {
+			nodeMap[root] = ngraph.AddNode(clusterSums[root].Scale(1 / float64(clusterCounts[root])))
+			nodeMap[root].Attributes = node.Attributes.Clone()
+		}
+		nodeMap[node.ID] = nodeMap[root]
+	}
+	report.MergedNodes = len(graph.Nodes) - len(ngraph.Nodes)
+
+	for _, edge := range graph.Edges {
+		src, dst := nodeMap[edge.Src.ID], nodeMap[edge.Dst.ID]
+		if edge.Src == edge.Dst {
+			if options.RemoveSelfLoops {
+				report.SelfLoops++
+				continue
+			}
+		} else if src == dst {
+			// zero-length edges were already counted
+			if !options.RemoveZeroLength || edge.Segment().Length() != 0 {
+				report.CollapsedEdges++
+			}
+			continue
+		}
+		if ngraph.FindEdge(src, dst) != nil {
+			report.DuplicateEdges++
+			continue
+		}
+		ngraph.AddEdge(src, dst).Attributes = edge.Attributes.Clone()
+	}
+
+	if options.SpurLength > 0 {
+		ngraph = ngraph.pruneSpurs(options.SpurLength, &report)
+	}
+	return ngraph, report
+}
+
+// Remove dead-end chains shorter than maxLength that end at a junction.
+func (graph *Graph) pruneSpurs(maxLength float64, report *CleanReport) *Graph {
+	// distinct neighbors of each node, ignoring direction and self-loops
+	neighbors := make([][]*Node, len(graph.Nodes))
+	for _, node := range graph.Nodes {
+		seen := make(map[int]bool)
+		for _, edge := range node.Out {
+			if edge.Dst != node && !seen[edge.Dst.ID] {
+				seen[edge.Dst.ID] = true
+				neighbors[node.ID] = append(neighbors[node.ID], edge.Dst)
+			}
+		}
+		for _, edge := range node.In {
+			if edge.Src != node && !seen[edge.Src.ID] {
+				seen[edge.Src.ID] = true
+				neighbors[node.ID] = append(neighbors[node.ID], edge.Src)
+			}
+		}
+	}
+
+	badNodes := make(map[int]bool)
+	for _, node := range graph.Nodes {
+		if len(neighbors[node.ID]) != 1 || badNodes[node.ID] {
+			continue
+		}
+		chain := []*Node{node}
+		inChain := map[int]bool{node.ID: true}
+		prev := node
+		cur := neighbors[node.ID][0]
+		length := node.Point.Distance(cur.Point)
+		for len(neighbors[cur.ID]) == 2 && length < maxLength {
+			next := neighbors[cur.ID][0]
+			if next == prev {
+				next = neighbors[cur.ID][1]
+			}
+			if inChain[next.ID] {
+				break
+			}
+			chain = append(chain, cur)
+			inChain[cur.ID] = true
+			length += cur.Point.Distance(next.Point)
+			prev, cur = cur, next
+		}
+		// only prune if we reached a junction, otherwise this is an isolated road
+		if length >= maxLength || len(neighbors[cur.ID]) < 3 {
+			continue
+		}
+		report.Spurs++
+		for _, chainNode := range chain {
+			badNodes[chainNode.ID] = true
+		}
+	}
+	if len(badNodes) == 0 {
+		return graph
+	}
+
+	ngraph := &Graph{}
+	nodeMap := make(map[int]*Node)
+	for _, node := range graph.Nodes {
+		if !badNodes[node.ID] {
+			nodeMap[node.ID] = ngraph.AddNode(node.Point)
+			nodeMap[node.ID].Attributes = node.Attributes
+		}
+	}
+	for _, edge := range graph.Edges {
+		if badNodes[edge.Src.ID] || badNodes[edge.Dst.ID] {
+			report.SpurEdges++
+			continue
+		}
+		ngraph.AddEdge(nodeMap[edge.Src.ID], nodeMap[edge.Dst.ID]).Attributes = edge.Attributes
+	}
+	return ngraph
+}
@@ -0,0 +1,158 @@
+package common
+
+// Label the weakly connected components of the graph, i.e., ignoring edge direction.
+// Returns the component of each node (indexed by node ID) and the number of components.
+func (graph *Graph) ConnectedComponents() ([]int, int) {
+	labels := make([]int, len(graph.Nodes))
+	for i := range labels {
+		labels[i] = -1
+	}
+	count := 0
+	for _, node := range graph.Nodes {
+		if labels[node.ID] != -1 {
+			continue
+		}
+		labels[node.ID] = count
+		queue := []*Node{node}
+		for len(queue) > 0 {
+			cur := queue[len(queue) - 1]
+			queue = queue[:len(queue) - 1]
+			for _, edge := range cur.Out {
+				if labels[edge.Dst.ID] == -1 {
+					labels[edge.Dst.ID] = count
+					queue = append(queue, edge.Dst)
+				}
+			}
+			for _, edge := range cur.In {
+				if labels[edge.Src.ID] == -1 {
+					labels[edge.Src.ID] = count
+					queue = append(queue, edge.Src)
+				}
+			}
+		}
+		count++
+	}
+	return labels, count
+}
+
+// Label the strongly connected components of the graph using Tarjan's algorithm.
+// Returns the component of each node (indexed by node ID) and the number of components.
+// The search is iterative so that long roads do not overflow the stack.
+func (graph *Graph) StronglyConnectedComponents() ([]int, int) {
+	n := len(graph.Nodes)
+	labels := make([]int, n)
+	index := make([]int, n)
+	lowlink := make([]int, n)
+	onStack := make([]bool, n)
+	for i := range labels {
+		labels[i] = -1
+		index[i] = -1
+	}
+	var stack []int
+	counter := 0
+	count := 0
+
+	type frame struct {
+		nodeID int
+		edgeIdx int
+	}
+	visit := func(nodeID int) frame {
+		index[nodeID] = counter
+		lowlink[nodeID] = counter
+		counter++
+		stack = append(stack, nodeID)
+		onStack[nodeID] = true
+		return frame{nodeID, 0}
+	}
+
+	for _, root := range graph.Nodes {
+		if index[root.ID] != -1 {
+			continue
+		}
+		callStack := []frame{visit(root.ID)}
+		for len(callStack) > 0 {
+			top := len(callStack) - 1
+			nodeID := callStack[top].nodeID
+			node := graph.Nodes[nodeID]
+			if callStack[top].edgeIdx < len(node.Out) {
+				other := node.Out[callStack[top].edgeIdx].Dst.ID
+				callStack[top].edgeIdx++
+				if index[other] == -1 {
+					callStack = append(callStack, visit(other))
+				} else if onStack[other] && index[other] < lowlink[nodeID] {
+					lowlink[nodeID] = index[other]
+				}
+				continue
+			}
+
+			// finished with this node, pop its component if it is the root of one
+			if lowlink[nodeID] == index[nodeID] {
+				for {
+					member := stack[len(stack) - 1]
+					stack = stack[:len(stack) - 1]
+					onStack[member] = false
+					labels[member] = count
+					if member == nodeID {
+						break
+					}
+				}
+				count++
+			}
+			callStack = callStack[:top]
+			if top > 0 {
+				parentID := callStack[top - 1].nodeID
+				if lowlink[nodeID] < lowlink[parentID] {
+					lowlink[parentID] = lowlink[nodeID]
+				}
+			}
+		}
+	}
+	return labels, count
+}
+
+// Extract the component with the most nodes as a new graph.
+// If strong is true, strongly connected components are used, otherwise weakly connected
+// components. Like FilterEdgesWithMaps, also returns maps from old node and edge IDs to
+// the nodes and edges in the new graph.
+func (graph *Graph) LargestComponentWithMaps(strong bool) (*Graph, map[int]*Node, map[int]*Edge) {
+	var labels []int
+	var count int
+	if strong {
+		labels, count = graph.StronglyConnectedComponents()
+	} else {
+		labels, count = graph.ConnectedComponents()
+	}
+	sizes := make([]int, count)
+	for _, label := range labels {
+		sizes[label]++
+	}
+	largest := -1
+	for label, size := range sizes {
+		if largest == -1 || size > sizes[largest] {
+			largest = label
+		}
+	}
+
+	other := &Graph{}
+	nodeMap := make(map[int]*Node)
+	edgeMap := make(map[int]*Edge)
+	for _, node := range graph.Nodes {
+		if labels[node.ID] == largest {
+			nodeMap[node.ID] = other.AddNode(node.Point)
+			nodeMap[node.ID].Attributes = node.Attributes.Clone()
+		}
+	}
+	for _, edge := range graph.Edges {
+		if nodeMap[edge.Src.ID] == nil || nodeMap[edge.Dst.ID] == nil {
+			continue
+		}
+		edgeMap[edge.ID] = other.AddEdge(nodeMap[edge.Src.ID], nodeMap[edge.Dst.ID])
+		edgeMap[edge.ID].Attributes = edge.Attributes.Clone()
+	}
+	return other, nodeMap, edgeMap
+}
+
+func (graph *Graph) LargestComponent(strong bool) *Graph {
+	ngraph, _, _ := graph.LargestComponentWithMaps(strong)
+	return ngraph
+}
@@ -0,0 +1,40 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestComponents(t *testing.T) {
+	// a directed cycle a -> b -> c -> a, a tail c -> d, and a separate edge e <-> f
+	graph := &Graph{}
+	a := graph.AddNode(Point{0, 0})
+	b := graph.AddNode(Point{1, 0})
+	c := graph.AddNode(Point{1, 1})
+	d := graph.AddNode(Point{2, 1})
+	e := graph.AddNode(Point{5, 5})
+	f := graph.AddNode(Point{6, 5})
+	graph.AddEdge(a, b)
+	graph.AddEdge(b, c)
+	graph.AddEdge(c, a)
+	graph.AddEdge(c, d)
+	graph.AddBidirectionalEdge(e, f)
+
+	labels, count := graph.ConnectedComponents()
+	if count != 2 || labels[a.ID] != labels[d.ID] || labels[a.ID] == labels[e.ID] || labels[e.ID] != labels[f.ID] {
+		t.Fatalf("bad weak components %v (%d)", labels, count)
+	}
+
+	labels, count = graph.StronglyConnectedComponents()
+	if count != 3 || labels[a.ID] != labels[b.ID] || labels[a.ID] != labels[c.ID] || labels[a.ID] == labels[d.ID] || labels[e.ID] != labels[f.ID] {
+		t.Fatalf("bad strong components %v (%d)", labels, count)
+	}
+
+	largest, nodeMap, edgeMap := graph.LargestComponentWithMaps(false)
+	if len(largest.Nodes) != 4 || len(largest.Edges) != 4 || nodeMap[e.ID] != nil {
+		t.Fatalf("expected 4 nodes and 4 edges in largest weak component, got %d and %d", len(largest.Nodes), len(largest.Edges))
+	}
+	largest, nodeMap, edgeMap = graph.LargestComponentWithMaps(true)
+	if len(largest.Nodes) != 3 || len(largest.Edges) != 3 || nodeMap[d.ID] != nil || len(edgeMap) != 3 {
+		t.Fatalf("expected 3 nodes and 3 edges in largest strong component, got %d and %d", len(largest.Nodes), len(largest.Edges))
+	}
+}
@@ -0,0 +1,157 @@
+package common
+
+import (
+	"fmt"
+	"math"
+)
+
+// Edges that are within this distance of the other graph everywhere are unchanged.
+const DIFF_EPSILON = 1e-6
+
+// Colors used by GraphDiff.SVGElements.
+const DIFF_UNCHANGED_COLOR = "gray"
+const DIFF_MOVED_COLOR = "orange"
+const DIFF_ADDED_COLOR = "green"
+const DIFF_REMOVED_COLOR = "red"
+
+type EdgeDiff struct {
+	Edge *Edge
+
+	// closest edge in the other graph, or nil for added and removed edges
+	Match *Edge
+
+	// maximum distance from points along Edge to the other graph
+	Distance float64
+}
+
+type GraphDiffStats struct {
+	Unchanged int `json:"unchanged"`
+	Moved int `json:"moved"`
+	Added int `json:"added"`
+	Removed int `json:"removed"`
+
+	// Total length of road in each category, in graph units (meters if the graphs have
+	// been converted with LonLatToMeters). Both directions of a bidirectional road are
+	// counted once.
+	UnchangedLength float64 `json:"unchanged_length"`
+	MovedLength float64 `json:"moved_length"`
+	AddedLength float64 `json:"added_length"`
+	RemovedLength float64 `json:"removed_length"`
+}
+
+type GraphDiff struct {
+	// Edges from the new graph that lie on the old graph.
+	Unchanged []EdgeDiff
+
+	// Edges from the new graph that are within the tolerance of the old graph, but not on it.
+	Moved []EdgeDiff
+
+	// Edges from the new graph that are not within the tolerance of the old graph.
+	Added []EdgeDiff
+
+	// Edges from the old graph that are not within the tolerance of the new graph.
+	Removed []EdgeDiff
+
+	Stats GraphDiffStats
+}
+
+// Compare the old (before) and new (after) versions of a graph covering the same area.
+// Edges are matched geometrically, ignoring direction and how roads are split into
+// edges: an edge matches if every point along it is within tolerance of the other graph.
+// The tolerance must be positive.
+func DiffGraphs(before *Graph, after *Graph, tolerance float64) (GraphDiff, error) {
+	if !(tolerance > 0) {
+		return GraphDiff{}, fmt.Errorf("tolerance must be positive, got %v", tolerance)
+	}
+	var diff GraphDiff
+	afterIndex := after.GridIndex(tolerance * 10)
+	beforeIndex := before.GridIndex(tolerance * 10)
+
+	// returns the maximum distance from the edge to the other graph (capped just above
+	// tolerance), along with the other graph's edge that is closest to the edge midpoint
+	compare := func(edge *Edge, index GraphGridIndex) (float64, *Edge) {
+		segment := edge.Segment()
+		var maxDistance float64
+		for _, p := range segment.Sample(tolerance / 2) {
+			distance := math.Inf(1)
+			for _, other := range index.Search(p.RectangleTol(tolerance)) {
+				distance = math.Min(distance, other.Segment().Distance(p))
+			}
+			maxDistance = math.Max(maxDistance, distance)
+			if maxDistance > tolerance {
+				return maxDistance, nil
+			}
+		}
+		var match *Edge
+		var bestDistance float64
+		mid := segment.PointAtFactor(0.5, true)
+		for _, other := range index.Search(mid.RectangleTol(tolerance)) {
+			distance := other.Segment().Distance(mid)
+			if match == nil || distance < bestDistance {
+				match = other
+				bestDistance = distance
+			}
+		}
+		return maxDistance, match
+	}
+
+	// length that the edge contributes to the road length
+	roadLength := func(edge *Edge) float64 {
+		for _, other := range edge.Dst.Out {
+			if other.Dst == edge.Src {
+				return edge.Segment().Length() / 2
+			}
+		}
+		return edge.Segment().Length()
+	}
+
+	for _, edge := range after.Edges {
+		distance, match := compare(edge, beforeIndex)
+		ediff := EdgeDiff{edge, match, distance}
+		if match == nil {
+			ediff.Distance = math.Inf(1)
+			diff.Added = append(diff.Added, ediff)
+			diff.Stats.Added++
+			diff.Stats.AddedLength += roadLength(edge)
+		} else if distance <= DIFF_EPSILON {
+			diff.Unchanged = append(diff.Unchanged, ediff)
+			diff.Stats.Unchanged++
+			diff.Stats.UnchangedLength += roadLength(edge)
+		} else {
+			diff.Moved = append(diff.Moved, ediff)
+			diff.Stats.Moved++
+			diff.Stats.MovedLength += roadLength(edge)
+		}
+	}
+	for _, edge := range before.Edges {
+		_, match := compare(edge, afterIndex)
+		if match != nil {
+			continue
+		}
+		diff.Removed = append(diff.Removed, EdgeDiff{edge, nil, math.Inf(1)})
+		diff.Stats.Removed++
+		diff.Stats.RemovedLength += roadLength(edge)
+	}
+	return diff, nil
+}
+
+// Returns layers for CreateSVG that draw each category of the diff in its own color.
+func (diff GraphDiff) SVGElements() [][]Boundable {
+	var elements [][]Boundable
+	for _, category := range []struct{
+		edges []EdgeDiff
+		color string
+	}{
+		{diff.Unchanged, DIFF_UNCHANGED_COLOR},
+		{diff.Moved, DIFF_MOVED_COLOR},
+		{diff.Removed, DIFF_REMOVED_COLOR},
+		{diff.Added, DIFF_ADDED_COLOR},
+	} {
+		var layer []Boundable
+		for _, ediff := range category.edges {
+			layer = append(layer, ColoredBoundable{ediff.Edge.Segment(), category.color})
+		}
+		elements = append(elements, layer)
+	}
+	return elements
+}
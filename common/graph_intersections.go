@@ -0,0 +1,124 @@
+package common
+
+// A group of nodes in the original graph that represent one physical intersection.
+type IntersectionCluster struct {
+	// the node that replaces the cluster in the consolidated graph
+	Node *Node
+
+	// IDs of the original nodes in the cluster
+	Members []int
+}
+
+// Replace clusters of nearby junctions with a single node at their centroid.
+// Junctions are nodes with at least three distinct neighbors; two junctions are in the
+// same cluster if they are within radius of each other, directly or through other
+// junctions in the cluster. Degree-two nodes within radius of two members of a cluster
+// that they connect (e.g. along the short connector of a divided road) are absorbed into it.
+// Edges inside a cluster are removed and the other incident edges are reconnected to the
+// new node, merging edges that become parallel.
+// Returns the new graph, the clusters with more than one member, and a map from old node
+// IDs to new nodes.
+func (graph *Graph) ConsolidateIntersectionsWithMaps(radius float64) (*Graph, []IntersectionCluster, map[int]*Node) {
+	neighbors := make([]map[int]bool, len(graph.Nodes))
+	for _, node := range graph.Nodes {
+		neighbors[node.ID] = make(map[int]bool)
+	}
+	for _, edge := range graph.Edges {
+		if edge.Src != edge.Dst {
+			neighbors[edge.Src.ID][edge.Dst.ID] = true
+			neighbors[edge.Dst.ID][edge.Src.ID] = true
+		}
+	}
+
+	parents := make([]int, len(graph.Nodes))
+	for i := range parents {
+		parents[i] = i
+	}
+	var find func(id int) int
+	find = func(id int) int {
+		if parents[id] != id {
+			parents[id] = find(parents[id])
+		}
+		return parents[id]
+	}
+
+	idx := NewGridIndex(radius)
+	for _, node := range graph.Nodes {
+		if len(neighbors[node.ID]) >= 3 {
+			idx.Insert(node.ID, node.Point.Rectangle())
+		}
+	}
+	for _, node := range graph.Nodes {
+		if len(neighbors[node.ID]) < 3 {
+			continue
+		}
+		for _, otherID := range idx.Search(node.Point.RectangleTol(radius)) {
+			if otherID != node.ID && node.Point.Distance(graph.Nodes[otherID].Point) <= radius {
+				a, b := find(node.ID), find(otherID)
+				if a != b {
+					parents[b] = a
+				}
+			}
+		}
+	}
+
+	// absorb degree-two nodes that connect two junctions of the same cluster
+	for _, node := range graph.Nodes {
+		if len(neighbors[node.ID]) != 2 {
+			continue
+		}
+		var ids []int
+		for id := range neighbors[node.ID] {
+			ids = append(ids, id)
+		}
+		if len(neighbors[ids[0]]) < 3 || len(neighbors[ids[1]]) < 3 || find(ids[0]) != find(ids[1]) {
+			continue
+		} else if node.Point.Distance(graph.Nodes[ids[0]].Point) > radius || node.Point.Distance(graph.Nodes[ids[1]].Point) > radius {
+			continue
+		}
+		parents[node.ID] = find(ids[0])
+	}
+
+	// compute centroids and create the new nodes
+	members := make(map[int][]int)
+	for _, node := range graph.Nodes {
+		root := find(node.ID)
+		members[root] = append(members[root], node.ID)
+	}
+	ngraph := &Graph{}
+	nodeMap := make(map[int]*Node)
+	var clusters []IntersectionCluster
+	for _, node := range graph.Nodes {
+		root := find(node.ID)
+		if nodeMap[root] == nil {
+			var sum Point
+			for _, id := range members[root] {
+				sum = sum.Add(graph.Nodes[id].Point)
+			}
+			first := graph.Nodes[members[root][0]]
+			nodeMap[root] = ngraph.AddNode(sum.Scale(1 / float64(len(members[root]))))
+			nodeMap[root].Attributes = first.Attributes.Clone()
+			if len(members[root]) > 1 {
+				clusters = append(clusters, IntersectionCluster{nodeMap[root], members[root]})
+			}
+		}
+		nodeMap[node.ID] = nodeMap[root]
+	}
+
+	for _, edge := range graph.Edges {
+		src, dst := nodeMap[edge.Src.ID], nodeMap[edge.Dst.ID]
+		if src == dst && edge.Src != edge.Dst {
+			continue
+		}
+		if ngraph.FindEdge(src, dst) != nil {
+			continue
+		}
+		ngraph.AddEdge(src, dst).Attributes = edge.Attributes.Clone()
+	}
+	return ngraph, clusters, nodeMap
+}
+
+func (graph *Graph) ConsolidateIntersections(radius float64) (*Graph, []IntersectionCluster) {
+	ngraph, clusters, _ := graph.ConsolidateIntersectionsWithMaps(radius)
+	return ngraph, clusters
+}
@@ -0,0 +1,198 @@
+package common
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+)
+
+// default concavity passed to GetConcaveHull when building isochrone polygons
+const ISOCHRONE_CONCAVITY = 2
+
+type IsochroneParams struct {
+	// Source, exactly one must be specified (as in FollowParams).
+	SourceNodes []*Node
+	SourcePos EdgePos
+
+	// Distance thresholds, one isochrone is computed for each threshold.
+	Distances []float64
+
+	// If true, find the parts of the graph that can reach the source rather than the
+	// parts that are reachable from the source.
+	Backwards bool
+
+	// override edge length
+	EdgeLengths map[int]float64
+
+	// Parameters for the enclosing polygon, see GetConcaveHull.
+	// Edges are sampled at HullLengthThreshold so that long edges follow the boundary.
+	Concavity float64
+	HullLengthThreshold float64
+}
+
+// Part of an edge, between two distances from edge.Src.
+type PartialEdge struct {
+	Edge *Edge
+	Start float64
+	End float64
+}
+
+func (pe PartialEdge) Segment() Segment {
+	segment := pe.Edge.Segment()
+	return Segment{
+		segment.PointAtFactor(pe.Start, false),
+		segment.PointAtFactor(pe.End, false),
+	}
+}
+
+type Isochrone struct {
+	Distance float64
+
+	// edges that are traversed completely within the distance
+	Edges []*Edge
+
+	// edges that are only partially traversed, clipped at the distance
+	PartialEdges []PartialEdge
+
+	Polygon Polygon
+}
+
+// Compute the parts of the graph that are within each of params.Distances from the source.
+// Unlike Follow, this finds the shortest distance to each node, so every edge is clipped
+// at the correct position.
+// Returns an error if the source is missing or invalid.
+func (graph *Graph) Isochrones(params IsochroneParams) ([]Isochrone, error) {
+	if len(params.SourceNodes) > 0 && params.SourcePos.Edge != nil {
+		return nil, fmt.Errorf("only one of SourceNodes and SourcePos can be specified")
+	} else if len(params.SourceNodes) == 0 && params.SourcePos.Edge == nil {
+		return nil, fmt.Errorf("one of SourceNodes and SourcePos must be specified")
+	} else if edge := params.SourcePos.Edge; edge != nil && (params.SourcePos.Position < 0 || params.SourcePos.Position > edge.Segment().Length()) {
+		return nil, fmt.Errorf("source position %f is not on edge %d", params.SourcePos.Position, edge.ID)
+	}
+
+	var maxDistance float64
+	for _, d := range params.Distances {
+		maxDistance = math.Max(maxDistance, d)
+	}
+	sp := ShortestPathParams{EdgeLengths: params.EdgeLengths}
+
+	// Dijkstra from all of the sources at once, stopping at maxDistance
+	distances := make([]float64, len(graph.Nodes))
+	for i := range distances {
+		distances[i] = math.Inf(1)
+	}
+	pq := &priorityQueue{}
+	addSource := func(node *Node, d float64) {
+		if d < distances[node.ID] {
+			distances[node.ID] = d
+			heap.Push(pq, pqItem{node.ID, d})
+		}
+	}
+	sourceEdge := params.SourcePos.Edge
+	if len(params.SourceNodes) > 0 {
+		for _, node := range params.SourceNodes {
+			addSource(node, 0)
+		}
+	} else if params.Backwards {
+		addSource(sourceEdge.Src, params.SourcePos.Position / sourceEdge.Segment().Length() * sp.GetEdgeLength(sourceEdge))
+	} else {
+		addSource(sourceEdge.Dst, (1 - params.SourcePos.Position / sourceEdge.Segment().Length()) * sp.GetEdgeLength(sourceEdge))
+	}
+	for pq.Len() > 0 {
+		item := heap.Pop(pq).(pqItem)
+		if item.priority > distances[item.id] {
+			continue
+		} else if item.priority > maxDistance {
+			break
+		}
+		node := graph.Nodes[item.id]
+		edges := node.Out
+		if params.Backwards {
+			edges = node.In
+		}
+		for _, edge := range edges {
+			other := edge.Dst
+			if params.Backwards {
+				other = edge.Src
+			}
+			d := item.priority + sp.GetEdgeLength(edge)
+			if d < distances[other.ID] {
+				distances[other.ID] = d
+				heap.Push(pq, pqItem{other.ID, d})
+			}
+		}
+	}
+
+	isochrones := make([]Isochrone, len(params.Distances))
+	for i, threshold := range params.Distances {
+		isochrone := Isochrone{Distance: threshold}
+		var points []Point
+		addSegment := func(segment Segment) {
+			if params.HullLengthThreshold > 0 {
+				points = append(points, segment.Sample(params.HullLengthThreshold)...)
+			} else {
+				points = append(points, segment.Start, segment.End)
+			}
+		}
+
+		for _, edge := range graph.Edges {
+			// how far along the edge (in geometric length, from the end nearer the source)
+			// we get before reaching the threshold
+			length := edge.Segment().Length()
+			scale := 1.0
+			if l := sp.GetEdgeLength(edge); l > 0 {
+				scale = length / l
+			}
+			var start float64
+			if params.Backwards {
+				start = distances[edge.Dst.ID]
+			} else {
+				start = distances[edge.Src.ID]
+			}
+			reach := (threshold - start) * scale
+
+			// parts of the edge within the threshold, as distances from edge.Src
+			var parts []PartialEdge
+			if reach >= 0 {
+				if params.Backwards {
+					parts = append(parts, PartialEdge{edge, math.Max(0, length - reach), length})
+				} else {
+					parts = append(parts, PartialEdge{edge, 0, math.Min(length, reach)})
+				}
+			}
+			if edge == sourceEdge {
+				// the source edge is also traversed directly from the source position
+				pos := params.SourcePos.Position
+				var pe PartialEdge
+				if params.Backwards {
+					pe = PartialEdge{edge, math.Max(0, pos - threshold * scale), pos}
+				} else {
+					pe = PartialEdge{edge, pos, math.Min(length, pos + threshold * scale)}
+				}
+				// if we come back around to the source edge, the two parts may overlap
+				if len(parts) > 0 && parts[0].Start <= pe.End && pe.Start <= parts[0].End {
+					parts[0] = PartialEdge{edge, math.Min(parts[0].Start, pe.Start), math.Max(parts[0].End, pe.End)}
+				} else {
+					parts = append(parts, pe)
+				}
+			}
+			for _, pe := range parts {
+				if pe.Start <= 0 && pe.End >= length {
+					isochrone.Edges = append(isochrone.Edges, edge)
+					addSegment(edge.Segment())
+				} else if pe.End > pe.Start {
+					isochrone.PartialEdges = append(isochrone.PartialEdges, pe)
+					addSegment(pe.Segment())
+				}
+			}
+		}
+
+		concavity := params.Concavity
+		if concavity == 0 {
+			concavity = ISOCHRONE_CONCAVITY
+		}
+		isochrone.Polygon = GetConcaveHull(points, concavity, params.HullLengthThreshold)
+		isochrones[i] = isochrone
+	}
+	return isochrones, nil
+}
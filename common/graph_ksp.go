@@ -0,0 +1,132 @@
+package common
+
+import (
+	"math"
+)
+
+type WeightedPath struct {
+	// Full node sequence, including the source and destination.
+	Nodes []*Node
+	Length float64
+}
+
+func sameNodePath(a []*Node, b []*Node) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Find up to k shortest loopless paths from src to dst in order of increasing length,
+// using Yen's algorithm on top of ShortestPath.
+// Edges are removed from the spur searches by overriding their length with +Inf, so
+// params.EdgeLengths is respected. If params.MaxDistance is set, longer paths are omitted.
+func (graph *Graph) KShortestPaths(src *Node, dst *Node, k int, params ShortestPathParams) []WeightedPath {
+	if k <= 0 {
+		return nil
+	}
+	pathLength := func(nodes []*Node) float64 {
+		var length float64
+		for i := 1; i < len(nodes); i++ {
+			length += params.GetEdgeLength(graph.FindEdge(nodes[i - 1], nodes[i]))
+		}
+		return length
+	}
+
+	result := graph.ShortestPath(src, ShortestPathParams{
+		StopNodes: []*Node{dst},
+		EdgeLengths: params.EdgeLengths,
+	})
+	if src != dst && result.GetPathTo(dst) == nil {
+		return nil
+	}
+	first := WeightedPath{
+		Nodes: result.GetFullPathTo(dst),
+		Length: result.Distances[dst.ID],
+	}
+	if params.MaxDistance != 0 && first.Length > params.MaxDistance {
+		return nil
+	}
+	paths := []WeightedPath{first}
+	var candidates []WeightedPath
+
+	isKnown := func(nodes []*Node) bool {
+		for _, path := range paths {
+			if sameNodePath(path.Nodes, nodes) {
+				return true
+			}
+		}
+		for _, path := range candidates {
+			if sameNodePath(path.Nodes, nodes) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for len(paths) < k {
+		prev := paths[len(paths) - 1]
+		for i := 0; i < len(prev.Nodes) - 1; i++ {
+			spurNode := prev.Nodes[i]
+			rootPath := prev.Nodes[:i+1]
+
+			edgeLengths := make(map[int]float64, len(params.EdgeLengths))
+			for edgeID, length := range params.EdgeLengths {
+				edgeLengths[edgeID] = length
+			}
+			// remove the next edge of every known path that shares this root
+			for _, path := range paths {
+				if len(path.Nodes) > i + 1 && sameNodePath(path.Nodes[:i+1], rootPath) {
+					edge := graph.FindEdge(path.Nodes[i], path.Nodes[i + 1])
+					edgeLengths[edge.ID] = math.Inf(1)
+				}
+			}
+			// remove the root path nodes (other than the spur node) so the path stays loopless
+			for _, node := range rootPath[:i] {
+				for _, edge := range node.In {
+					edgeLengths[edge.ID] = math.Inf(1)
+				}
+				for _, edge := range node.Out {
+					edgeLengths[edge.ID] = math.Inf(1)
+				}
+			}
+
+			spurResult := graph.ShortestPath(spurNode, ShortestPathParams{
+				StopNodes: []*Node{dst},
+				EdgeLengths: edgeLengths,
+			})
+			spurPath := spurResult.GetPathTo(dst)
+			if spurPath == nil {
+				continue
+			}
+			nodes := append(append([]*Node{}, rootPath...), spurPath...)
+			if isKnown(nodes) {
+				continue
+			}
+			length := pathLength(rootPath) + spurResult.Distances[dst.ID]
+			if params.MaxDistance != 0 && length > params.MaxDistance {
+				continue
+			}
+			candidates = append(candidates, WeightedPath{nodes, length})
+		}
+
+		if len(candidates) == 0 {
+			break
+		}
+		bestIdx := 0
+		for i, candidate := range candidates {
+			if candidate.Length < candidates[bestIdx].Length {
+				bestIdx = i
+			}
+		}
+		paths = append(paths, candidates[bestIdx])
+		candidates = append(candidates[:bestIdx], candidates[bestIdx+1:]...)
+	}
+
+	return paths
+}
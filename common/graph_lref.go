@@ -0,0 +1,217 @@
+package common
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// A location along a road segment, as the distance from the start of the segment.
+// Since offsets are distances along the road, they do not change when edges are split
+// (e.g. by Densify), see LinearReference.Rebase.
+type SegmentPos struct {
+	SegmentID int
+	Offset float64
+}
+
+// Returns the offset of the position along the road segment, or -1 if the position is
+// not on one of its edges.
+func (rs RoadSegment) Offset(pos EdgePos) float64 {
+	distance := rs.DistanceOfEdge(pos.Edge)
+	if distance < 0 {
+		return -1
+	}
+	return distance + pos.Position
+}
+
+type PointEvent struct {
+	SegmentPos
+	Attributes Attributes
+}
+
+type RangeEvent struct {
+	SegmentID int
+	Start float64
+	End float64
+	Attributes Attributes
+}
+
+// Point and range events (e.g. stops, speed profiles, map-matching coverage) keyed by
+// positions along road segments.
+type LinearReference struct {
+	Segments []RoadSegment
+
+	// events on each segment, sorted by offset (or start offset for ranges)
+	PointEvents map[int][]PointEvent
+	RangeEvents map[int][]RangeEvent
+
+	// spatial index over the edges of all segments, for projecting points
+	// edgeRefs holds the segment ID and index in the segment of each indexed edge
+	idx *GridIndex
+	edgeRefs [][2]int
+
+	// source and destination node IDs of each segment, recorded when the linear
+	// reference is created since in-place operations like Densify modify the edges
+	endpoints [][2]int
+}
+
+// Create a linear reference over road segments from GetRoadSegments.
+// Segments are looked up by ID, so the ID of each segment must be its index.
+func NewLinearReference(roadSegments []RoadSegment) *LinearReference {
+	lr := &LinearReference{
+		Segments: roadSegments,
+		PointEvents: make(map[int][]PointEvent),
+		RangeEvents: make(map[int][]RangeEvent),
+	}
+
+	// use the average edge length as the grid size
+	var total float64
+	var count int
+	for _, rs := range roadSegments {
+		total += rs.Length()
+		count += len(rs.Edges)
+	}
+	gridSize := 1.0
+	if count > 0 && total > 0 {
+		gridSize = total / float64(count)
+	}
+	lr.idx = NewGridIndex(gridSize)
+	for _, rs := range roadSegments {
+		lr.endpoints = append(lr.endpoints, [2]int{rs.Src().ID, rs.Dst().ID})
+		for i, edge := range rs.Edges {
+			lr.idx.Insert(len(lr.edgeRefs), edge.Segment().Bounds())
+			lr.edgeRefs = append(lr.edgeRefs, [2]int{rs.ID, i})
+		}
+	}
+	return lr
+}
+
+func (lr *LinearReference) AddPointEvent(pos SegmentPos, attributes Attributes) {
+	events := lr.PointEvents[pos.SegmentID]
+	i := sort.Search(len(events), func(i int) bool {
+		return events[i].Offset > pos.Offset
+	})
+	events = append(events, PointEvent{})
+	copy(events[i + 1:], events[i:])
+	events[i] = PointEvent{pos, attributes}
+	lr.PointEvents[pos.SegmentID] = events
+}
+
+func (lr *LinearReference) AddRangeEvent(segmentID int, start float64, end float64, attributes Attributes) {
+	if end < start {
+		start, end = end, start
+	}
+	events := lr.RangeEvents[segmentID]
+	i := sort.Search(len(events), func(i int) bool {
+		return events[i].Start > start
+	})
+	events = append(events, RangeEvent{})
+	copy(events[i + 1:], events[i:])
+	events[i] = RangeEvent{segmentID, start, end, attributes}
+	lr.RangeEvents[segmentID] = events
+}
+
+// Returns point events on the segment with start <= offset <= end.
+func (lr *LinearReference) PointEventsIn(segmentID int, start float64, end float64) []PointEvent {
+	events := lr.PointEvents[segmentID]
+	i := sort.Search(len(events), func(i int) bool {
+		return events[i].Offset >= start
+	})
+	var result []PointEvent
+	for ; i < len(events) && events[i].Offset <= end; i++ {
+		result = append(result, events[i])
+	}
+	return result
+}
+
+// Returns range events on the segment that overlap [start, end].
+// Use start == end to get the ranges that contain a single offset.
+func (lr *LinearReference) RangeEventsIn(segmentID int, start float64, end float64) []RangeEvent {
+	var result []RangeEvent
+	for _, event := range lr.RangeEvents[segmentID] {
+		if event.Start > end {
+			break
+		}
+		if event.End >= start {
+			result = append(result, event)
+		}
+	}
+	return result
+}
+
+// Returns the edge position corresponding to a segment position.
+func (lr *LinearReference) EdgePos(pos SegmentPos) EdgePos {
+	return lr.Segments[pos.SegmentID].PosAtFactor(pos.Offset)
+}
+
+func (lr *LinearReference) Point(pos SegmentPos) Point {
+	return lr.EdgePos(pos).Point()
+}
+
+// Project a point onto the closest road segment within maxDistance.
+// Returns false if there is no road segment within maxDistance.
+func (lr *LinearReference) Project(p Point, maxDistance float64) (SegmentPos, bool) {
+	var best SegmentPos
+	bestDistance := math.Inf(1)
+	for _, id := range lr.idx.Search(p.RectangleTol(maxDistance)) {
+		rs := lr.Segments[lr.edgeRefs[id][0]]
+		i := lr.edgeRefs[id][1]
+		pos := rs.Edges[i].ClosestPos(p)
+		distance := pos.Point().Distance(p)
+		if distance <= maxDistance && distance < bestDistance {
+			best = SegmentPos{rs.ID, rs.EdgeDistances[i] + pos.Position}
+			bestDistance = distance
+		}
+	}
+	return best, !math.IsInf(bestDistance, 1)
+}
+
+// Project each observation of the trace onto the closest road segment within
+// maxDistance. Observations that are not near any segment get SegmentID -1.
+func (lr *LinearReference) ProjectTrace(trace *Trace, maxDistance float64) []SegmentPos {
+	positions := make([]SegmentPos, len(trace.Observations))
+	for i, obs := range trace.Observations {
+		pos, ok := lr.Project(obs.Point, maxDistance)
+		if !ok {
+			pos = SegmentPos{-1, 0}
+		}
+		positions[i] = pos
+	}
+	return positions
+}
+
+// Move the events onto new road segments computed from a modified version of the graph,
+// e.g. after Densify. Each old segment is matched with a new segment that has the same
+// endpoint node IDs and the same length.
+func (lr *LinearReference) Rebase(roadSegments []RoadSegment) (*LinearReference, error) {
+	byEndpoints := make(map[[2]int][]RoadSegment)
+	for _, rs := range roadSegments {
+		k := [2]int{rs.Src().ID, rs.Dst().ID}
+		byEndpoints[k] = append(byEndpoints[k], rs)
+	}
+	nlr := NewLinearReference(roadSegments)
+	for _, rs := range lr.Segments {
+		pointEvents, rangeEvents := lr.PointEvents[rs.ID], lr.RangeEvents[rs.ID]
+		if len(pointEvents) == 0 && len(rangeEvents) == 0 {
+			continue
+		}
+		var match *RoadSegment
+		for _, other := range byEndpoints[lr.endpoints[rs.ID]] {
+			if math.Abs(other.Length() - rs.Length()) <= 1e-6 * math.Max(1, rs.Length()) {
+				other := other
+				match = &other
+				break
+			}
+		}
+		if match == nil {
+			return nil, fmt.Errorf("no matching road segment for segment %d", rs.ID)
+		}
+		for _, event := range pointEvents {
+			nlr.AddPointEvent(SegmentPos{match.ID, event.Offset}, event.Attributes)
+		}
+		for _, event := range rangeEvents {
+			nlr.AddRangeEvent(match.ID, event.Start, event.End, event.Attributes)
+		}
+	}
+	return nlr, nil
+}
@@ -0,0 +1,281 @@
+package common
+
+import (
+	"sort"
+)
+
+type MergeOptions struct {
+	// Nodes from different graphs that are closer than this are merged into one node, and
+	// nodes that are closer than this to an edge from a different graph are inserted into
+	// that edge. Nodes from the same graph are never merged with each other.
+	SnapTolerance float64
+
+	// Also insert shared nodes where edges from different graphs cross.
+	// This ignores bridges and tunnels, so leave it off for graphs that have them.
+	SplitCrossings bool
+}
+
+// Identifies a node or edge in one of the graphs passed to MergeGraphs.
+type GraphRef struct {
+	Graph int
+	ID int
+}
+
+type MergeResult struct {
+	Graph *Graph
+
+	// new node ID -> the source nodes that were merged into it
+	// (empty for nodes created at crossings)
+	NodeSources map[int][]GraphRef
+
+	// new edge ID -> the source edges that it is (part of)
+	EdgeSources map[int][]GraphRef
+}
+
+// Union several graphs into one, e.g. tiles from LoadOSMMultiple or inferred maps of
+// neighboring regions. Unlike GraphFromEdges, nodes that are within options.SnapTolerance
+// of each other are merged, and edges that overlap or meet are stitched together.
+// Merged nodes and edges keep the attributes of their first source.
+func MergeGraphs(graphs []*Graph, options MergeOptions) MergeResult {
+	// combine the graphs, tracking where each node and edge came from
+	combined := &Graph{}
+	var nodeSources [][]GraphRef
+	var edgeSources [][]GraphRef
+	for graphIdx, graph := range graphs {
+		offset := len(combined.Nodes)
+		for _, node := range graph.Nodes {
+			combined.AddNode(node.Point).Attributes = node.Attributes.Clone()
+			nodeSources = append(nodeSources, []GraphRef{{graphIdx, node.ID}})
+		}
+		for _, edge := range graph.Edges {
+			nedge := &Edge{
+				ID: len(combined.Edges),
+				Src: combined.Nodes[offset + edge.Src.ID],
+				Dst: combined.Nodes[offset + edge.Dst.ID],
+				Attributes: edge.Attributes.Clone(),
+			}
+			// add directly rather than with AddEdge so that provenance stays aligned
+			combined.Edges = append(combined.Edges, nedge)
+			nedge.Src.Out = append(nedge.Src.Out, nedge)
+			nedge.Dst.In = append(nedge.Dst.In, nedge)
+			edgeSources = append(edgeSources, []GraphRef{{graphIdx, edge.ID}})
+		}
+	}
+
+	// (1) merge nearby nodes
+	parents := make([]int, len(combined.Nodes))
+	for i := range parents {
+		parents[i] = i
+	}
+	var find func(id int) int
+	find = func(id int) int {
+		if parents[id] != id {
+			parents[id] = find(parents[id])
+		}
+		return parents[id]
+	}
+	if options.SnapTolerance > 0 {
+		idx := NewGridIndex(options.SnapTolerance)
+		for _, node := range combined.Nodes {
+			idx.Insert(node.ID, node.Point.Rectangle())
+		}
+		// consider pairs of nodes from different graphs, closest first; a pair is merged
+		// if one of the nodes starts or is the seed of a cluster and the other is not yet
+		// clustered, and the cluster has no node from its graph yet. Nodes are only merged
+		// with a seed, so merges do not chain along densely sampled roads.
+		type nodePair struct {
+			a int
+			b int
+			distance float64
+		}
+		var pairs []nodePair
+		for _, node := range combined.Nodes {
+			for _, otherID := range idx.Search(node.Point.RectangleTol(options.SnapTolerance)) {
+				if otherID <= node.ID || nodeSources[otherID][0].Graph == nodeSources[node.ID][0].Graph {
+					continue
+				}
+				distance := node.Point.Distance(combined.Nodes[otherID].Point)
+				if distance <= options.SnapTolerance {
+					pairs = append(pairs, nodePair{node.ID, otherID, distance})
+				}
+			}
+		}
+		sort.Slice(pairs, func(i, j int) bool {
+			if pairs[i].distance != pairs[j].distance {
+				return pairs[i].distance < pairs[j].distance
+			} else if pairs[i].a != pairs[j].a {
+				return pairs[i].a < pairs[j].a
+			}
+			return pairs[i].b < pairs[j].b
+		})
+		clustered := make([]bool, len(combined.Nodes))
+		clusterGraphs := make(map[int]map[int]bool)
+		for _, pair := range pairs {
+			seed, other := pair.a, pair.b
+			if clustered[seed] && parents[seed] != seed {
+				seed, other = other, seed
+			}
+			if clustered[other] || (clustered[seed] && parents[seed] != seed) {
+				continue
+			}
+			if clusterGraphs[seed] == nil {
+				clusterGraphs[seed] = map[int]bool{nodeSources[seed][0].Graph: true}
+			}
+			otherGraph := nodeSources[other][0].Graph
+			if clusterGraphs[seed][otherGraph] {
+				continue
+			}
+			clusterGraphs[seed][otherGraph] = true
+			clustered[seed] = true
+			clustered[other] = true
+			parents[other] = seed
+		}
+	}
+
+	merged := &Graph{}
+	mergedNodeSources := make(map[int][]GraphRef)
+	mergedEdgeSources := make(map[int][]GraphRef)
+	nodeMap := make(map[int]*Node)
+	for _, node := range combined.Nodes {
+		root := find(node.ID)
+		if nodeMap[root] == nil {
+			nodeMap[root] = merged.AddNode(combined.Nodes[root].Point)
+			nodeMap[root].Attributes = combined.Nodes[root].Attributes
+		}
+		nodeMap[node.ID] = nodeMap[root]
+		mergedNodeSources[nodeMap[root].ID] = append(mergedNodeSources[nodeMap[root].ID], nodeSources[node.ID]...)
+	}
+
+	// graphs that each merged node and edge came from
+	graphSet := func(refs []GraphRef) map[int]bool {
+		set := make(map[int]bool)
+		for _, ref := range refs {
+			set[ref.Graph] = true
+		}
+		return set
+	}
+	disjoint := func(a []GraphRef, b []GraphRef) bool {
+		set := graphSet(a)
+		for _, ref := range b {
+			if set[ref.Graph] {
+				return false
+			}
+		}
+		return true
+	}
+
+	var mergedEdges []*Edge
+	var mergedEdgeRefs [][]GraphRef
+	for _, edge := range combined.Edges {
+		src, dst := nodeMap[edge.Src.ID], nodeMap[edge.Dst.ID]
+		if src == dst {
+			continue
+		}
+		mergedEdges = append(mergedEdges, &Edge{ID: len(mergedEdges), Src: src, Dst: dst, Attributes: edge.Attributes})
+		mergedEdgeRefs = append(mergedEdgeRefs, edgeSources[edge.ID])
+	}
+
+	// (2) insert nodes into nearby edges from other graphs, which stitches T-junctions
+	// and edges that overlap along tile boundaries
+	// A node that has been inserted into an edge also counts as part of that edge's
+	// graphs, so that overlapping edges pick up each other's nodes; we repeat until
+	// no more nodes are inserted.
+	type split struct {
+		position float64
+		node *Node
+	}
+	var splits map[int][]split
+	if options.SnapTolerance > 0 {
+		nodeGraphs := make([]map[int]bool, len(merged.Nodes))
+		for _, node := range merged.Nodes {
+			nodeGraphs[node.ID] = graphSet(mergedNodeSources[node.ID])
+		}
+		idx := NewGridIndex(options.SnapTolerance * 4)
+		for _, edge := range mergedEdges {
+			idx.Insert(edge.ID, edge.Segment().Bounds())
+		}
+		for changed := true; changed; {
+			changed = false
+			splits = make(map[int][]split)
+			for _, node := range merged.Nodes {
+				for _, edgeID := range idx.Search(node.Point.RectangleTol(options.SnapTolerance)) {
+					edge := mergedEdges[edgeID]
+					if edge.Src == node || edge.Dst == node {
+						continue
+					}
+					edgeGraphs := graphSet(mergedEdgeRefs[edgeID])
+					other := false
+					for graphIdx := range nodeGraphs[node.ID] {
+						if !edgeGraphs[graphIdx] {
+							other = true
+						}
+					}
+					if !other {
+						continue
+					}
+					segment := edge.Segment()
+					if segment.Distance(node.Point) > options.SnapTolerance {
+						continue
+					}
+					position := segment.Project(node.Point, false)
+					if position <= 0 || position >= segment.Length() {
+						continue
+					}
+					splits[edgeID] = append(splits[edgeID], split{position, node})
+					for graphIdx := range edgeGraphs {
+						if !nodeGraphs[node.ID][graphIdx] {
+							nodeGraphs[node.ID][graphIdx] = true
+							changed = true
+						}
+					}
+				}
+			}
+		}
+	}
+
+	for _, edge := range mergedEdges {
+		l := splits[edge.ID]
+		sort.Slice(l, func(i, j int) bool {
+			return l[i].position < l[j].position
+		})
+		chain := []*Node{edge.Src}
+		for _, s := range l {
+			chain = append(chain, s.node)
+		}
+		chain = append(chain, edge.Dst)
+		for i := 1; i < len(chain); i++ {
+			if chain[i - 1] == chain[i] {
+				continue
+			}
+			nedge := merged.FindEdge(chain[i - 1], chain[i])
+			if nedge == nil {
+				nedge = merged.AddEdge(chain[i - 1], chain[i])
+				nedge.Attributes = edge.Attributes.Clone()
+			}
+			mergedEdgeSources[nedge.ID] = append(mergedEdgeSources[nedge.ID], mergedEdgeRefs[edge.ID]...)
+		}
+	}
+
+	result := MergeResult{
+		Graph: merged,
+		NodeSources: mergedNodeSources,
+		EdgeSources: mergedEdgeSources,
+	}
+	if !options.SplitCrossings {
+		return result
+	}
+
+	// (3) split crossings between edges from different graphs
+	planar, edgeMap := merged.Planarize(PlanarizeOptions{
+		ShouldSplit: func(a *Edge, b *Edge) bool {
+			return disjoint(mergedEdgeSources[a.ID], mergedEdgeSources[b.ID])
+		},
+		Tolerance: options.SnapTolerance,
+	})
+	result.Graph = planar
+	result.EdgeSources = make(map[int][]GraphRef)
+	for newID, oldID := range edgeMap {
+		result.EdgeSources[newID] = mergedEdgeSources[oldID]
+	}
+	return result
+}
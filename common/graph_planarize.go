@@ -0,0 +1,184 @@
+package common
+
+import (
+	"math"
+	"sort"
+)
+
+type PlanarizeOptions struct {
+	// Edges that should never be split, as sets of edge IDs of this graph. For a graph
+	// loaded from OSM, these would be LayerEdges[i] and TunnelEdges[i] (for bridges and
+	// tunnels), where i is the graph's region index.
+	SkipEdges []map[int]bool
+
+	// If set, a crossing between two edges is only split if this returns true.
+	ShouldSplit func(a *Edge, b *Edge) bool
+
+	// Crossings within this distance of an existing edge endpoint, or of another
+	// crossing, reuse that node instead of creating a new one.
+	Tolerance float64
+}
+
+func (options PlanarizeOptions) isSkipped(edge *Edge) bool {
+	for _, m := range options.SkipEdges {
+		if m[edge.ID] {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a copy of the graph where edges that cross without a shared node are split at
+// the crossing so that they share one. Bidirectional edge pairs are split at the same node.
+// Nodes keep their IDs in the new graph (crossing nodes are added after them). Also
+// returns a map from new edge IDs to the IDs of the original edges they came from.
+func (graph *Graph) Planarize(options PlanarizeOptions) (*Graph, map[int]int) {
+	tol := math.Max(options.Tolerance, 1e-9)
+
+	// edges between the same pair of nodes are processed together, using the segment
+	// from the lower node ID to the higher one
+	type segmentKey [2]int
+	getKey := func(edge *Edge) segmentKey {
+		if edge.Src.ID < edge.Dst.ID {
+			return segmentKey{edge.Src.ID, edge.Dst.ID}
+		} else {
+			return segmentKey{edge.Dst.ID, edge.Src.ID}
+		}
+	}
+	getSegment := func(k segmentKey) Segment {
+		return Segment{graph.Nodes[k[0]].Point, graph.Nodes[k[1]].Point}
+	}
+
+	ngraph := &Graph{}
+	for _, node := range graph.Nodes {
+		ngraph.AddNode(node.Point).Attributes = node.Attributes.Clone()
+	}
+
+	// nodes to insert along each segment, by position from the lower ID node
+	type split struct {
+		position float64
+		nodeID int
+	}
+	splits := make(map[segmentKey][]split)
+
+	// crossing nodes in a grid with cells of size tol, so that three or more edges
+	// crossing at one point share a node
+	crossingCells := make(map[[2]int][]*Node)
+	getCell := func(p Point) [2]int {
+		return [2]int{int(math.Floor(p.X / tol)), int(math.Floor(p.Y / tol))}
+	}
+	getCrossing := func(p Point) *Node {
+		cell := getCell(p)
+		for i := cell[0] - 1; i <= cell[0] + 1; i++ {
+			for j := cell[1] - 1; j <= cell[1] + 1; j++ {
+				for _, node := range crossingCells[[2]int{i, j}] {
+					if node.Point.Distance(p) <= tol {
+						return node
+					}
+				}
+			}
+		}
+		node := ngraph.AddNode(p)
+		crossingCells[cell] = append(crossingCells[cell], node)
+		return node
+	}
+
+	rtree := graph.Rtree()
+	seenPairs := make(map[[2]segmentKey]bool)
+	for _, edge := range graph.Edges {
+		if edge.Src == edge.Dst || options.isSkipped(edge) {
+			continue
+		}
+		keyA := getKey(edge)
+		segmentA := getSegment(keyA)
+		for _, other := range rtree.Search(segmentA.Bounds().AddTol(tol)) {
+			keyB := getKey(other)
+			if keyA == keyB || other.Src == other.Dst || edge.IsAdjacent(other) || options.isSkipped(other) {
+				continue
+			}
+			pair := [2]segmentKey{keyA, keyB}
+			if keyB[0] < keyA[0] || (keyB[0] == keyA[0] && keyB[1] < keyA[1]) {
+				pair = [2]segmentKey{keyB, keyA}
+			}
+			if seenPairs[pair] {
+				continue
+			}
+			seenPairs[pair] = true
+			if options.ShouldSplit != nil && !options.ShouldSplit(edge, other) {
+				continue
+			}
+
+			segmentB := getSegment(keyB)
+			p := segmentA.Intersection(segmentB)
+			if p == nil || segmentA.Distance(*p) > tol || segmentB.Distance(*p) > tol {
+				// Intersection returns a point for collinear segments even if they do not overlap
+				continue
+			}
+
+			// reuse an existing endpoint if the crossing is at (or near) one
+			nearEndpoint := func(k segmentKey, segment Segment) (float64, int) {
+				position := segment.Project(*p, false)
+				if position <= tol {
+					return position, k[0]
+				} else if position >= segment.Length() - tol {
+					return position, k[1]
+				}
+				return position, -1
+			}
+			positionA, nodeA := nearEndpoint(keyA, segmentA)
+			positionB, nodeB := nearEndpoint(keyB, segmentB)
+			if nodeA != -1 && nodeB != -1 {
+				// the segments only touch at their endpoints
+				continue
+			}
+			var nodeID int
+			if nodeA != -1 {
+				nodeID = nodeA
+			} else if nodeB != -1 {
+				nodeID = nodeB
+			} else {
+				nodeID = getCrossing(*p).ID
+			}
+			if nodeA == -1 {
+				splits[keyA] = append(splits[keyA], split{positionA, nodeID})
+			}
+			if nodeB == -1 {
+				splits[keyB] = append(splits[keyB], split{positionB, nodeID})
+			}
+		}
+	}
+
+	for _, l := range splits {
+		sort.Slice(l, func(i, j int) bool {
+			return l[i].position < l[j].position
+		})
+	}
+
+	edgeMap := make(map[int]int)
+	for _, edge := range graph.Edges {
+		k := getKey(edge)
+		chain := []int{k[0]}
+		for _, s := range splits[k] {
+			if s.nodeID != chain[len(chain) - 1] {
+				chain = append(chain, s.nodeID)
+			}
+		}
+		if k[1] != chain[len(chain) - 1] {
+			chain = append(chain, k[1])
+		}
+		if edge.Src.ID != k[0] {
+			for i, j := 0, len(chain) - 1; i < j; i, j = i + 1, j - 1 {
+				chain[i], chain[j] = chain[j], chain[i]
+			}
+		}
+		if edge.Src == edge.Dst {
+			chain = []int{edge.Src.ID, edge.Dst.ID}
+		}
+		for i := 1; i < len(chain); i++ {
+			nedge := ngraph.AddEdge(ngraph.Nodes[chain[i - 1]], ngraph.Nodes[chain[i]])
+			nedge.Attributes = edge.Attributes.Clone()
+			edgeMap[nedge.ID] = edge.ID
+		}
+	}
+	return ngraph, edgeMap
+}
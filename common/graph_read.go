@@ -15,8 +15,11 @@ func ReadChicagoMap(fname string) (*Graph, error) {
 		return nil, err
 	}
 	defer file.Close()
+	return ReadChicagoMapFrom(file)
+}
 
-	reader := bufio.NewReader(file)
+func ReadChicagoMapFrom(r io.Reader) (*Graph, error) {
+	reader := bufio.NewReader(r)
 	m := make(map[string]*Node)
 	graph := &Graph{}
 
@@ -64,16 +67,25 @@ func ReadChicagoMap(fname string) (*Graph, error) {
 }
 
 func ReadDaviesMap(verticesFname string, edgesFname string) (*Graph, error) {
+	verticesFile, err := os.Open(verticesFname)
+	if err != nil {
+		return nil, err
+	}
+	defer verticesFile.Close()
+	edgesFile, err := os.Open(edgesFname)
+	if err != nil {
+		return nil, err
+	}
+	defer edgesFile.Close()
+	return ReadDaviesMapFrom(verticesFile, edgesFile)
+}
+
+func ReadDaviesMapFrom(verticesReader io.Reader, edgesReader io.Reader) (*Graph, error) {
 	graph := &Graph{}
 	vertexIDMap := make(map[string]*Node)
 
 	readVertices := func() error {
-		file, err := os.Open(verticesFname)
-		if err != nil {
-			return err
-		}
-		defer file.Close()
-		reader := bufio.NewReader(file)
+		reader := bufio.NewReader(verticesReader)
 		for {
 			line, err := reader.ReadString('\n')
 			if err != nil {
@@ -98,12 +110,7 @@ func ReadDaviesMap(verticesFname string, edgesFname string) (*Graph, error) {
 	}
 
 	readEdges := func() error {
-		file, err := os.Open(edgesFname)
-		if err != nil {
-			return err
-		}
-		defer file.Close()
-		reader := bufio.NewReader(file)
+		reader := bufio.NewReader(edgesReader)
 		for {
 			line, err := reader.ReadString('\n')
 			if err != nil {
@@ -134,16 +141,25 @@ func ReadDaviesMap(verticesFname string, edgesFname string) (*Graph, error) {
 }
 
 func ReadAhmedMap(verticesFname string, edgesFname string) (*Graph, error) {
+	verticesFile, err := os.Open(verticesFname)
+	if err != nil {
+		return nil, err
+	}
+	defer verticesFile.Close()
+	edgesFile, err := os.Open(edgesFname)
+	if err != nil {
+		return nil, err
+	}
+	defer edgesFile.Close()
+	return ReadAhmedMapFrom(verticesFile, edgesFile)
+}
+
+func ReadAhmedMapFrom(verticesReader io.Reader, edgesReader io.Reader) (*Graph, error) {
 	graph := &Graph{}
 	vertexIDMap := make(map[string]*Node)
 
 	readVertices := func() error {
-		file, err := os.Open(verticesFname)
-		if err != nil {
-			return err
-		}
-		defer file.Close()
-		reader := bufio.NewReader(file)
+		reader := bufio.NewReader(verticesReader)
 		for {
 			line, err := reader.ReadString('\n')
 			if err != nil {
@@ -168,12 +184,7 @@ func ReadAhmedMap(verticesFname string, edgesFname string) (*Graph, error) {
 	}
 
 	readEdges := func() error {
-		file, err := os.Open(edgesFname)
-		if err != nil {
-			return err
-		}
-		defer file.Close()
-		reader := bufio.NewReader(file)
+		reader := bufio.NewReader(edgesReader)
 		for {
 			line, err := reader.ReadString('\n')
 			if err != nil {
@@ -209,8 +220,11 @@ func ReadKharitaMap(fname string) (*Graph, error) {
 		return nil, err
 	}
 	defer file.Close()
+	return ReadKharitaMapFrom(file)
+}
 
-	reader := bufio.NewReader(file)
+func ReadKharitaMapFrom(r io.Reader) (*Graph, error) {
+	reader := bufio.NewReader(r)
 	m := make(map[[2]string]*Node)
 	graph := &Graph{}
 
@@ -257,8 +271,11 @@ func ReadEdelkampMap(fname string) (*Graph, error) {
 		return nil, err
 	}
 	defer file.Close()
+	return ReadEdelkampMapFrom(file)
+}
 
-	reader := bufio.NewReader(file)
+func ReadEdelkampMapFrom(r io.Reader) (*Graph, error) {
+	reader := bufio.NewReader(r)
 	m := make(map[[2]string]*Node)
 	graph := &Graph{}
 
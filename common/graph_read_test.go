@@ -0,0 +1,97 @@
+package common
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMapFormats(t *testing.T) {
+	graph := &Graph{}
+	a := graph.AddNode(Point{-71.1, 42.3})
+	b := graph.AddNode(Point{-71.0, 42.3})
+	c := graph.AddNode(Point{-71.0, 42.4})
+	graph.AddBidirectionalEdge(a, b)
+	graph.AddEdge(b, c)
+
+	// edges as (src, dst) point pairs, since node IDs are not kept by every format
+	edgeSet := func(graph *Graph) map[[2]Point]bool {
+		set := make(map[[2]Point]bool)
+		for _, edge := range graph.Edges {
+			set[[2]Point{edge.Src.Point, edge.Dst.Point}] = true
+		}
+		return set
+	}
+	checkEdges := func(format string, other *Graph, expected map[[2]Point]bool) {
+		otherSet := edgeSet(other)
+		if len(other.Edges) != len(expected) || len(otherSet) != len(expected) {
+			t.Fatalf("%s: expected %d edges but got %d", format, len(expected), len(other.Edges))
+		}
+		for k := range expected {
+			if !otherSet[k] {
+				t.Fatalf("%s: missing edge %v", format, k)
+			}
+		}
+	}
+
+	singleFormats := []struct {
+		name string
+		write func(*Graph, *bytes.Buffer) error
+		read func(*bytes.Buffer) (*Graph, error)
+	}{
+		{"chicago", func(g *Graph, buf *bytes.Buffer) error { return g.WriteChicagoMapTo(buf) }, func(buf *bytes.Buffer) (*Graph, error) { return ReadChicagoMapFrom(buf) }},
+		{"kharita", func(g *Graph, buf *bytes.Buffer) error { return g.WriteKharitaMapTo(buf) }, func(buf *bytes.Buffer) (*Graph, error) { return ReadKharitaMapFrom(buf) }},
+		{"edelkamp", func(g *Graph, buf *bytes.Buffer) error { return g.WriteEdelkampMapTo(buf) }, func(buf *bytes.Buffer) (*Graph, error) { return ReadEdelkampMapFrom(buf) }},
+	}
+	for _, format := range singleFormats {
+		var buf bytes.Buffer
+		if err := format.write(graph, &buf); err != nil {
+			t.Fatal(err)
+		}
+		other, err := format.read(&buf)
+		if err != nil {
+			t.Fatalf("%s: %v", format.name, err)
+		}
+		if len(other.Nodes) != 3 {
+			t.Fatalf("%s: expected 3 nodes but got %d", format.name, len(other.Nodes))
+		}
+		checkEdges(format.name, other, edgeSet(graph))
+	}
+
+	// Ahmed keeps node IDs and directions
+	var vertices, edges bytes.Buffer
+	if err := graph.WriteAhmedMapTo(&vertices, &edges); err != nil {
+		t.Fatal(err)
+	}
+	other, err := ReadAhmedMapFrom(&vertices, &edges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, edge := range graph.Edges {
+		if other.Edges[i].Src.ID != edge.Src.ID || other.Edges[i].Dst.ID != edge.Dst.ID {
+			t.Fatalf("ahmed: edge %d was not read back", i)
+		}
+	}
+	checkEdges("ahmed", other, edgeSet(graph))
+
+	// Davies is undirected, so the one-way edge comes back bidirectional
+	dir, err := ioutil.TempDir("", "mapformats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	verticesFname := filepath.Join(dir, "vertices.txt")
+	edgesFname := filepath.Join(dir, "edges.txt")
+	if err := graph.WriteDaviesMap(verticesFname, edgesFname); err != nil {
+		t.Fatal(err)
+	}
+	other, err = ReadDaviesMap(verticesFname, edgesFname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := edgeSet(graph)
+	expected[[2]Point{c.Point, b.Point}] = true
+	checkEdges("davies", other, expected)
+}
@@ -97,40 +97,77 @@ func (rs RoadSegment) Bounds() Rectangle {
 	return r
 }
 
+// Returns whether a road segment passes through the node, i.e., the node has exactly two
+// distinct neighbors A and B, and every edge into the node from one neighbor continues
+// with an edge out to the other neighbor. This holds for nodes along bidirectional roads
+// and along one-way roads, but not where a one-way road meets a bidirectional road.
+func (node *Node) isRoadSegmentInterior() bool {
+	neighbors := make(map[*Node]bool)
+	for _, edge := range node.Out {
+		if edge.Dst == node {
+			return false
+		}
+		neighbors[edge.Dst] = true
+	}
+	for _, edge := range node.In {
+		if edge.Src == node {
+			return false
+		}
+		neighbors[edge.Src] = true
+	}
+	if len(neighbors) != 2 || len(node.In) != len(node.Out) || len(node.In) > 2 {
+		return false
+	}
+	for _, in := range node.In {
+		found := false
+		for _, out := range node.Out {
+			if out.Dst != in.Src {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
 // Get road segments, i.e., sequences of edges between junctions.
-// Junctions are vertices where the number of incident edges != 2.
-// This function only works for bidirectional graphs.
-func (graph *Graph) GetRoadSegments() []RoadSegment {
+// Junctions are nodes that a road segment cannot pass through: nodes that do not have
+// exactly two neighbors, nodes with self-loops, and nodes where the directionality of
+// the road changes. Bidirectional roads yield one road segment in each direction, and
+// one-way roads yield a single road segment. A self-loop is a road segment by itself.
+func (graph *Graph) GetRoadSegments() ([]RoadSegment, error) {
 	var roadSegments []RoadSegment
 	seenEdges := make(map[int]bool)
 
 	// Incorporate a new road segment with the specified starting edge.
-	// If expectLoop is false, this should start from a junction or dead end node.
+	// If expectLoop is false, this should start from a junction.
 	// If expectLoop is true, initialEdge can be an arbitrary edge along an isolated loop.
-	incorporate := func(initialEdge *Edge, expectLoop bool) {
+	incorporate := func(initialEdge *Edge, expectLoop bool) error {
 		edges := []*Edge{initialEdge}
 		seenEdges[initialEdge.ID] = true
 		prevEdge := initialEdge
 		for {
-			if len(prevEdge.Dst.Out) != 2 {
+			if !prevEdge.Dst.isRoadSegmentInterior() {
 				if expectLoop {
-					panic(fmt.Errorf("ran into junction vertex while following loop"))
+					return fmt.Errorf("ran into junction node %d while following loop", prevEdge.Dst.ID)
 				}
 				break
 			}
 			var nextEdge *Edge
-			if prevEdge.Dst.Out[0].Dst != prevEdge.Src {
-				nextEdge = prevEdge.Dst.Out[0]
-			} else if prevEdge.Dst.Out[1].Dst != prevEdge.Src {
-				nextEdge = prevEdge.Dst.Out[1]
-			} else {
-				panic(fmt.Errorf("got stuck following edge"))
+			for _, edge := range prevEdge.Dst.Out {
+				if edge.Dst != prevEdge.Src {
+					nextEdge = edge
+				}
 			}
 			if nextEdge == initialEdge {
 				if !expectLoop {
-					panic(fmt.Errorf("unexpectedly entered loop"))
+					return fmt.Errorf("unexpectedly entered loop at edge %d", initialEdge.ID)
 				}
 				break
+			} else if seenEdges[nextEdge.ID] {
+				return fmt.Errorf("edge %d is on more than one road segment", nextEdge.ID)
 			}
 			edges = append(edges, nextEdge)
 			seenEdges[nextEdge.ID] = true
@@ -138,18 +175,21 @@ func (graph *Graph) GetRoadSegments() []RoadSegment {
 		}
 		rs, err := NewRoadSegment(edges)
 		if err != nil {
-			panic(err)
+			return err
 		}
 		rs.ID = len(roadSegments)
 		roadSegments = append(roadSegments, rs)
+		return nil
 	}
 
 	for _, node := range graph.Nodes {
-		if len(node.Out) == 2 {
+		if node.isRoadSegmentInterior() {
 			continue
 		}
 		for _, edge := range node.Out {
-			incorporate(edge, false)
+			if err := incorporate(edge, false); err != nil {
+				return nil, err
+			}
 		}
 	}
 	// if there is a loop that is disconnected from the rest of the graph, it is not added above
@@ -158,16 +198,18 @@ func (graph *Graph) GetRoadSegments() []RoadSegment {
 		if seenEdges[edge.ID] {
 			continue
 		}
-		if len(edge.Src.Out) != 2 || len(edge.Dst.Out) != 2 {
-			panic(fmt.Errorf("missing edge does not look like a loop"))
+		if err := incorporate(edge, true); err != nil {
+			return nil, err
 		}
-		incorporate(edge, true)
 	}
-	return roadSegments
+	return roadSegments, nil
 }
 
-func (graph *Graph) GetRoadSegmentGraph() (*Graph, map[int]RoadSegment, map[int]*Node) {
-	roadSegments := graph.GetRoadSegments()
+func (graph *Graph) GetRoadSegmentGraph() (*Graph, map[int]RoadSegment, map[int]*Node, error) {
+	roadSegments, err := graph.GetRoadSegments()
+	if err != nil {
+		return nil, nil, nil, err
+	}
 	nodeMap := make(map[int]*Node)
 	edgeToSegment := make(map[int]RoadSegment)
 	g := &Graph{}
@@ -180,5 +222,5 @@ func (graph *Graph) GetRoadSegmentGraph() (*Graph, map[int]RoadSegment, map[int]
 		edge := g.AddEdge(nodeMap[rs.Src().ID], nodeMap[rs.Dst().ID])
 		edgeToSegment[edge.ID] = rs
 	}
-	return g, edgeToSegment, nodeMap
+	return g, edgeToSegment, nodeMap, nil
 }
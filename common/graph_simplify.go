@@ -0,0 +1,244 @@
+package common
+
+import (
+	"math"
+)
+
+// Simplify the graph by running RDP (like common.RDP) on each road segment from
+// GetRoadSegments. Junctions and dead ends are never moved or removed, and a simplified
+// segment is only accepted if it does not cross any other part of the graph, so no new
+// crossings are introduced. One-way roads stay one-way: a simplified edge only gets a
+// reverse edge if every edge that it replaces has one. Nodes without edges are kept.
+// Returns the simplified graph and a map from each new edge ID to the IDs of the
+// original edges that it replaces, in order. New edges take the attributes of the first
+// edge that they replace.
+func (graph *Graph) Simplify(epsilon float64) (*Graph, map[int][]int, error) {
+	roadSegments, err := graph.GetRoadSegments()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// all current segments of the graph, indexed spatially so that we can check candidate
+	// simplified segments for crossings
+	// we never delete from the index, instead we mark replaced segments as removed
+	gridSize := math.Max(epsilon * 10, graph.Bounds().Diagonal() / 1000)
+	if gridSize <= 0 {
+		gridSize = 1
+	}
+	idx := NewGridIndex(gridSize)
+	var segments []Segment
+	var removed []bool
+	addSegment := func(segment Segment) int {
+		id := len(segments)
+		segments = append(segments, segment)
+		removed = append(removed, false)
+		idx.Insert(id, segment.Bounds())
+		return id
+	}
+	crosses := func(segment Segment, ignore map[int]bool) bool {
+		for _, id := range idx.Search(segment.Bounds()) {
+			if removed[id] || ignore[id] {
+				continue
+			}
+			other := segments[id]
+			// segments that share an endpoint meet at a node, which is fine
+			if other.Start == segment.Start || other.Start == segment.End || other.End == segment.Start || other.End == segment.End {
+				continue
+			}
+			if segment.Intersection(other) != nil {
+				return true
+			}
+		}
+		return false
+	}
+
+	// chains of nodes to simplify, one per undirected road segment
+	type chain struct {
+		segment RoadSegment
+		nodes []*Node
+		segmentIDs []int
+	}
+	var chains []chain
+	seenEdges := make(map[int]bool)
+	for _, rs := range roadSegments {
+		if seenEdges[rs.Edges[0].ID] {
+			continue
+		}
+		c := chain{segment: rs, nodes: []*Node{rs.Src()}}
+		for _, edge := range rs.Edges {
+			seenEdges[edge.ID] = true
+			if opposite := edge.GetOpposite(); opposite != nil && opposite != edge {
+				seenEdges[opposite.ID] = true
+			}
+			c.nodes = append(c.nodes, edge.Dst)
+			c.segmentIDs = append(c.segmentIDs, addSegment(edge.Segment()))
+		}
+		chains = append(chains, c)
+	}
+
+	// pairs of nodes that are (or will be) directly connected by an edge
+	directPairs := make(map[[2]int]bool)
+	for _, c := range chains {
+		if len(c.nodes) == 2 {
+			directPairs[[2]int{c.nodes[0].ID, c.nodes[1].ID}] = true
+			directPairs[[2]int{c.nodes[1].ID, c.nodes[0].ID}] = true
+		}
+	}
+
+	ngraph := &Graph{}
+	nodeMap := make(map[int]*Node)
+	getNode := func(node *Node) *Node {
+		if nodeMap[node.ID] == nil {
+			nodeMap[node.ID] = ngraph.AddNode(node.Point)
+			nodeMap[node.ID].Attributes = node.Attributes.Clone()
+		}
+		return nodeMap[node.ID]
+	}
+	edgeMap := make(map[int][]int)
+
+	for _, c := range chains {
+		ignore := make(map[int]bool)
+		for _, id := range c.segmentIDs {
+			ignore[id] = true
+		}
+
+		// constrained RDP, returns the indices to keep between i and j (inclusive)
+		var simplify func(i int, j int) []int
+		simplify = func(i int, j int) []int {
+			if j - i < 2 {
+				return []int{i, j}
+			}
+			segment := Segment{c.nodes[i].Point, c.nodes[j].Point}
+			var dmax float64 = -1
+			index := i + 1
+			for k := i + 1; k < j; k++ {
+				d := segment.Distance(c.nodes[k].Point)
+				if d > dmax {
+					dmax = d
+					index = k
+				}
+			}
+			if dmax < epsilon && !crosses(segment, ignore) {
+				return []int{i, j}
+			}
+			prefix := simplify(i, index)
+			suffix := simplify(index, j)
+			return append(prefix[:len(prefix) - 1], suffix...)
+		}
+
+		last := len(c.nodes) - 1
+		// nodes where the chain changes between one-way and two-way are always kept
+		hasOpposite := func(k int) bool {
+			opposite := c.segment.Edges[k].GetOpposite()
+			return opposite != nil && opposite != c.segment.Edges[k]
+		}
+		forced := map[int]bool{0: true, last: true}
+		for k := 1; k < last; k++ {
+			if hasOpposite(k - 1) != hasOpposite(k) {
+				forced[k] = true
+			}
+		}
+		// simplify between consecutive forced nodes, and also keep node k if k > 0
+		splitAt := func(k int) []int {
+			kept := []int{0}
+			start := 0
+			for i := 1; i <= last; i++ {
+				if !forced[i] && i != k {
+					continue
+				}
+				kept = append(kept, simplify(start, i)[1:]...)
+				start = i
+			}
+			return kept
+		}
+		var kept []int
+		if c.nodes[0] == c.nodes[last] {
+			// isolated loop, split at the farthest node so the loop does not collapse
+			farthest := 1
+			for k := 1; k < last; k++ {
+				if c.nodes[k].Point.Distance(c.nodes[0].Point) > c.nodes[farthest].Point.Distance(c.nodes[0].Point) {
+					farthest = k
+				}
+			}
+			kept = splitAt(farthest)
+			if len(kept) < 4 {
+				kept = nil
+				for k := range c.nodes {
+					kept = append(kept, k)
+				}
+			}
+		} else {
+			kept = splitAt(0)
+			// do not create a second edge between nodes that are already connected
+			if len(kept) == 2 && last > 1 && directPairs[[2]int{c.nodes[0].ID, c.nodes[last].ID}] {
+				kept = splitAt(last / 2)
+			}
+		}
+
+		// make sure that the chain does not cross itself
+		var newSegments []Segment
+		for k := 1; k < len(kept); k++ {
+			newSegments = append(newSegments, Segment{c.nodes[kept[k - 1]].Point, c.nodes[kept[k]].Point})
+		}
+		selfCrossing := false
+		for a := range newSegments {
+			for b := a + 2; b < len(newSegments); b++ {
+				if a == 0 && b == len(newSegments) - 1 && c.nodes[0] == c.nodes[last] {
+					continue
+				}
+				if newSegments[a].Intersection(newSegments[b]) != nil {
+					selfCrossing = true
+				}
+			}
+		}
+		if selfCrossing {
+			kept = nil
+			newSegments = nil
+			for k := range c.nodes {
+				kept = append(kept, k)
+				if k > 0 {
+					newSegments = append(newSegments, Segment{c.nodes[k - 1].Point, c.nodes[k].Point})
+				}
+			}
+		}
+
+		for _, id := range c.segmentIDs {
+			removed[id] = true
+		}
+		for _, segment := range newSegments {
+			addSegment(segment)
+		}
+		if len(kept) == 2 {
+			directPairs[[2]int{c.nodes[0].ID, c.nodes[last].ID}] = true
+			directPairs[[2]int{c.nodes[last].ID, c.nodes[0].ID}] = true
+		}
+
+		for k := 1; k < len(kept); k++ {
+			src := getNode(c.nodes[kept[k - 1]])
+			dst := getNode(c.nodes[kept[k]])
+			var forward, backward []int
+			for _, edge := range c.segment.Edges[kept[k - 1]:kept[k]] {
+				forward = append(forward, edge.ID)
+				if opposite := edge.GetOpposite(); opposite != nil && opposite != edge {
+					backward = append([]int{opposite.ID}, backward...)
+				}
+			}
+			nedge := ngraph.AddEdge(src, dst)
+			nedge.Attributes = graph.Edges[forward[0]].Attributes.Clone()
+			edgeMap[nedge.ID] = forward
+			if len(backward) == len(forward) {
+				nedge = ngraph.AddEdge(dst, src)
+				nedge.Attributes = graph.Edges[backward[0]].Attributes.Clone()
+				edgeMap[nedge.ID] = backward
+			}
+		}
+	}
+
+	for _, node := range graph.Nodes {
+		if len(node.In) == 0 && len(node.Out) == 0 {
+			getNode(node)
+		}
+	}
+
+	return ngraph, edgeMap, nil
+}
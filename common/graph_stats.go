@@ -0,0 +1,141 @@
+package common
+
+import (
+	"sort"
+)
+
+type GraphStats struct {
+	Nodes int `json:"nodes"`
+	Edges int `json:"edges"`
+
+	// Number of roads, i.e., pairs of adjacent nodes regardless of direction, so a
+	// bidirectional road is counted once.
+	Roads int `json:"roads"`
+
+	// Edges that do not have a reverse edge.
+	OneWayEdges int `json:"one_way_edges"`
+
+	// True if every edge has a reverse edge.
+	Bidirectional bool `json:"bidirectional"`
+
+	// Total length of all edges.
+	EdgeLength float64 `json:"edge_length"`
+
+	// Total length of roads, counting both directions of a bidirectional road once.
+	RoadLength float64 `json:"road_length"`
+
+	// Number of nodes with each degree, where the degree of a node is its number of
+	// distinct neighbors regardless of edge direction.
+	DegreeHistogram map[int]int `json:"degree_histogram"`
+
+	// Nodes with degree at least three, and nodes with degree one.
+	Junctions int `json:"junctions"`
+	DeadEnds int `json:"dead_ends"`
+
+	// Weakly connected components, and their sizes in nodes, largest first.
+	Components int `json:"components"`
+	ComponentSizes []int `json:"component_sizes"`
+
+	// Sequences of roads between nodes with degree other than two, including isolated loops.
+	RoadSegments int `json:"road_segments"`
+
+	Bounds Rectangle `json:"bounds"`
+}
+
+// Compute summary statistics about the graph.
+// Roads are counted without regard to direction, so the same road network gives the
+// same numbers whether it is stored as a bidirectional or directed graph.
+func (graph *Graph) Stats() GraphStats {
+	stats := GraphStats{
+		Nodes: len(graph.Nodes),
+		Edges: len(graph.Edges),
+		Bidirectional: true,
+		DegreeHistogram: make(map[int]int),
+	}
+
+	// neighbors of each node regardless of direction
+	neighbors := make([]map[int]bool, len(graph.Nodes))
+	for _, node := range graph.Nodes {
+		neighbors[node.ID] = make(map[int]bool)
+	}
+	for _, edge := range graph.Edges {
+		length := edge.Segment().Length()
+		stats.EdgeLength += length
+		if graph.FindEdge(edge.Dst, edge.Src) == nil {
+			stats.OneWayEdges++
+			stats.Bidirectional = false
+			stats.RoadLength += length
+		} else {
+			stats.RoadLength += length / 2
+		}
+		if edge.Src == edge.Dst {
+			continue
+		}
+		neighbors[edge.Src.ID][edge.Dst.ID] = true
+		neighbors[edge.Dst.ID][edge.Src.ID] = true
+	}
+	for _, node := range graph.Nodes {
+		degree := len(neighbors[node.ID])
+		stats.Roads += degree
+		stats.DegreeHistogram[degree]++
+		if degree >= 3 {
+			stats.Junctions++
+		} else if degree == 1 {
+			stats.DeadEnds++
+		}
+	}
+	stats.Roads /= 2
+
+	labels, count := graph.ConnectedComponents()
+	stats.Components = count
+	stats.ComponentSizes = make([]int, count)
+	for _, label := range labels {
+		stats.ComponentSizes[label]++
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(stats.ComponentSizes)))
+
+	// follow chains of degree-two nodes from each other node
+	seen := make(map[[2]int]bool)
+	follow := func(prev int, cur int) {
+		seen[[2]int{prev, cur}] = true
+		seen[[2]int{cur, prev}] = true
+		for len(neighbors[cur]) == 2 {
+			next := -1
+			for id := range neighbors[cur] {
+				if id != prev {
+					next = id
+				}
+			}
+			if next == -1 || seen[[2]int{cur, next}] {
+				break
+			}
+			seen[[2]int{cur, next}] = true
+			seen[[2]int{next, cur}] = true
+			prev, cur = cur, next
+		}
+		stats.RoadSegments++
+	}
+	for _, node := range graph.Nodes {
+		if len(neighbors[node.ID]) == 2 {
+			continue
+		}
+		for id := range neighbors[node.ID] {
+			if !seen[[2]int{node.ID, id}] {
+				follow(node.ID, id)
+			}
+		}
+	}
+	// remaining roads are on loops that do not contain any junction
+	for _, node := range graph.Nodes {
+		for id := range neighbors[node.ID] {
+			if !seen[[2]int{node.ID, id}] {
+				follow(node.ID, id)
+			}
+		}
+	}
+
+	if len(graph.Nodes) > 0 {
+		stats.Bounds = graph.Bounds()
+	}
+	return stats
+}
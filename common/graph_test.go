@@ -1,7 +1,11 @@
 package common
 
 import (
+	"bytes"
+	"io/ioutil"
 	"math"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -24,3 +28,785 @@ func TestEdgeAngleTo(t *testing.T) {
 	check("e1->e3", math.Pi / 2, e1.AngleTo(e3))
 	check("e1->e4", math.Pi, e1.AngleTo(e4))
 }
+
+func TestClean(t *testing.T) {
+	// a road a-b-c with a short spur b-s, a self-loop at c, and a node a2 right next to a
+	graph := &Graph{}
+	a := graph.AddNode(Point{0, 0})
+	b := graph.AddNode(Point{10, 0})
+	c := graph.AddNode(Point{20, 0})
+	s := graph.AddNode(Point{10, 1})
+	a2 := graph.AddNode(Point{0, 0.01})
+	z := graph.AddNode(Point{20, 0})
+	graph.AddBidirectionalEdge(a, b)
+	graph.AddBidirectionalEdge(b, c)
+	graph.AddBidirectionalEdge(b, s)
+	graph.AddBidirectionalEdge(a2, b)
+	graph.AddBidirectionalEdge(c, z)
+	graph.AddEdge(c, c)
+	// parallel edge added directly since AddEdge does not allow it
+	dup := &Edge{ID: len(graph.Edges), Src: a, Dst: b}
+	graph.Edges = append(graph.Edges, dup)
+	a.Out = append(a.Out, dup)
+	b.In = append(b.In, dup)
+
+	cleaned, report := graph.Clean(CleanOptions{
+		RemoveSelfLoops: true,
+		RemoveZeroLength: true,
+		MergeTolerance: 0.1,
+		SpurLength: 2,
+	})
+	if report.SelfLoops != 1 || report.ZeroLengthEdges != 2 || report.DuplicateEdges != 3 || report.MergedNodes != 2 || report.Spurs != 1 || report.SpurEdges != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if len(cleaned.Nodes) != 3 || len(cleaned.Edges) != 4 {
+		t.Fatalf("expected 3 nodes and 4 edges but got %d and %d", len(cleaned.Nodes), len(cleaned.Edges))
+	}
+
+	// duplicate edges are removed even if no pass is enabled, since the cleaned graph is
+	// built with AddEdge
+	cleaned, report = graph.Clean(CleanOptions{})
+	if report.DuplicateEdges != 1 || len(cleaned.Edges) != len(graph.Edges) - 1 {
+		t.Fatalf("expected only the parallel edge to be removed but got %d of %d edges", len(cleaned.Edges), len(graph.Edges))
+	}
+	for _, node := range cleaned.Nodes {
+		seen := make(map[*Node]bool)
+		for _, edge := range node.Out {
+			if seen[edge.Dst] {
+				t.Fatalf("parallel edges from node %d", node.ID)
+			}
+			seen[edge.Dst] = true
+		}
+	}
+
+	// a densely sampled road is not merged into one node
+	graph = &Graph{}
+	prev := graph.AddNode(Point{0, 0})
+	for i := 1; i <= 10; i++ {
+		node := graph.AddNode(Point{float64(i), 0})
+		graph.AddBidirectionalEdge(prev, node)
+		prev = node
+	}
+	cleaned, _ = graph.Clean(CleanOptions{MergeTolerance: 1.5})
+	if len(cleaned.Nodes) != 6 {
+		t.Fatalf("expected 6 nodes after merging but got %d", len(cleaned.Nodes))
+	}
+}
+
+func TestRemoveAndCompact(t *testing.T) {
+	graph := &Graph{}
+	a := graph.AddNode(Point{0, 0})
+	b := graph.AddNode(Point{1, 0})
+	c := graph.AddNode(Point{2, 0})
+	graph.AddBidirectionalEdge(a, b)
+	bc := graph.AddBidirectionalEdge(b, c)
+
+	graph.RemoveNode(a)
+	graph.RemoveEdge(bc[1])
+	// IDs are unchanged until Compact
+	if b.ID != 1 || bc[0].ID != 2 || graph.Nodes[0] != nil {
+		t.Fatalf("expected removal to leave IDs unchanged")
+	}
+	nodeMap, edgeMap := graph.Compact()
+	if len(graph.Nodes) != 2 || len(graph.Edges) != 1 {
+		t.Fatalf("expected 2 nodes and 1 edge but got %d and %d", len(graph.Nodes), len(graph.Edges))
+	}
+	if nodeMap[1] != 0 || nodeMap[2] != 1 || len(nodeMap) != 2 || edgeMap[2] != 0 || len(edgeMap) != 1 {
+		t.Fatalf("bad maps %v %v", nodeMap, edgeMap)
+	}
+	for i, node := range graph.Nodes {
+		if node.ID != i {
+			t.Fatalf("node at index %d has ID %d", i, node.ID)
+		}
+	}
+	if b.ID != 0 || c.ID != 1 || bc[0].ID != 0 {
+		t.Fatalf("nodes and edges were not renumbered")
+	}
+	if len(b.In) != 0 || len(b.Out) != 1 || len(c.In) != 1 || len(c.Out) != 0 {
+		t.Fatalf("adjacency was not updated")
+	}
+
+	// removing an edge that is no longer in the graph does nothing
+	graph.RemoveEdge(bc[1])
+	if graph.Edges[0] != bc[0] {
+		t.Fatalf("expected remaining edge to be kept")
+	}
+
+	// the rest of the API works on the compacted graph
+	if bounds := graph.Bounds(); bounds.Min.X != 1 || bounds.Max.X != 2 {
+		t.Fatalf("bad bounds %v", bounds)
+	}
+	if clone := graph.Clone(); len(clone.Edges) != 1 || clone.Edges[0].Dst.ID != 1 {
+		t.Fatalf("bad clone")
+	}
+	if stats := graph.Stats(); stats.Nodes != 2 || stats.Edges != 1 {
+		t.Fatalf("bad stats %v", stats)
+	}
+	var buf bytes.Buffer
+	if err := graph.WriteTextTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if result := graph.ShortestPath(b, ShortestPathParams{}); result.Distances[c.ID] != 1 {
+		t.Fatalf("bad shortest path distance %v", result.Distances[c.ID])
+	}
+	if rs, err := graph.GetRoadSegments(); err != nil || len(rs) != 1 {
+		t.Fatalf("expected one road segment (err=%v)", err)
+	}
+}
+
+func TestPlanarize(t *testing.T) {
+	// two crossing roads, a bridge over both, and a road that ends on another road
+	graph := &Graph{}
+	road1 := graph.AddBidirectionalEdge(graph.AddNode(Point{0, 5}), graph.AddNode(Point{10, 5}))
+	graph.AddBidirectionalEdge(graph.AddNode(Point{5, 0}), graph.AddNode(Point{5, 10}))
+	bridge := graph.AddBidirectionalEdge(graph.AddNode(Point{0, 0}), graph.AddNode(Point{10, 10}))
+	graph.AddBidirectionalEdge(graph.AddNode(Point{2, 8}), graph.AddNode(Point{2, 5}))
+
+	layerEdges := map[int]bool{bridge[0].ID: true, bridge[1].ID: true}
+	ngraph, edgeMap := graph.Planarize(PlanarizeOptions{SkipEdges: []map[int]bool{layerEdges}})
+
+	// one new node at the crossing; road1 is split into three parts, the other road into two
+	if len(ngraph.Nodes) != len(graph.Nodes) + 1 {
+		t.Fatalf("expected %d nodes but got %d", len(graph.Nodes) + 1, len(ngraph.Nodes))
+	}
+	if len(ngraph.Edges) != 14 {
+		t.Fatalf("expected 14 edges but got %d", len(ngraph.Edges))
+	}
+	crossing := ngraph.Nodes[len(ngraph.Nodes) - 1]
+	if crossing.Point.Distance(Point{5, 5}) > 0.001 || len(crossing.Out) != 4 || len(crossing.In) != 4 {
+		t.Fatalf("bad crossing node %v", crossing)
+	}
+	if len(ngraph.Nodes[7].Out) != 3 {
+		t.Fatalf("expected T-junction node to have 3 outgoing edges but got %d", len(ngraph.Nodes[7].Out))
+	}
+	count := 0
+	for _, origID := range edgeMap {
+		if origID == road1[0].ID {
+			count++
+		}
+	}
+	if count != 3 {
+		t.Fatalf("expected road1 to be split into 3 edges but got %d", count)
+	}
+
+	// three roads crossing at one point share a single crossing node
+	graph = &Graph{}
+	graph.AddBidirectionalEdge(graph.AddNode(Point{-1, 0}), graph.AddNode(Point{1, 0}))
+	graph.AddBidirectionalEdge(graph.AddNode(Point{0, -1}), graph.AddNode(Point{0, 1}))
+	graph.AddBidirectionalEdge(graph.AddNode(Point{-1, -1}), graph.AddNode(Point{1, 1}))
+	ngraph, _ = graph.Planarize(PlanarizeOptions{Tolerance: 0.001})
+	if len(ngraph.Nodes) != 7 || len(ngraph.Edges) != 12 {
+		t.Fatalf("expected 7 nodes and 12 edges but got %d and %d", len(ngraph.Nodes), len(ngraph.Edges))
+	}
+	crossing = ngraph.Nodes[6]
+	if crossing.Point.Distance(Point{0, 0}) > 0.001 || len(crossing.Out) != 6 {
+		t.Fatalf("bad crossing node %v with %d outgoing edges", crossing, len(crossing.Out))
+	}
+}
+
+func TestMergeGraphs(t *testing.T) {
+	// two tiles that share a boundary road at y=10, with slightly different node positions,
+	// plus a road in the second tile that ends on the boundary road
+	g1 := &Graph{}
+	a := g1.AddNode(Point{0, 10})
+	b := g1.AddNode(Point{10, 10})
+	g1.AddBidirectionalEdge(a, b)
+	g1.AddBidirectionalEdge(g1.AddNode(Point{5, 0}), g1.AddNode(Point{5, 10.2}))
+	g2 := &Graph{}
+	c := g2.AddNode(Point{0.2, 10})
+	d := g2.AddNode(Point{10, 9.9})
+	g2.AddBidirectionalEdge(c, d)
+	g2.AddBidirectionalEdge(g2.AddNode(Point{3, 20}), g2.AddNode(Point{3, 10.1}))
+
+	result := MergeGraphs([]*Graph{g1, g2}, MergeOptions{SnapTolerance: 0.5})
+	ngraph := result.Graph
+
+	// the boundary endpoints are merged, and the two T-junctions are inserted into the
+	// boundary road of the other tile, so it ends up as three shared parts
+	if len(ngraph.Nodes) != 6 {
+		t.Fatalf("expected 6 nodes but got %d", len(ngraph.Nodes))
+	}
+	if len(ngraph.Edges) != 10 {
+		t.Fatalf("expected 10 edges but got %d", len(ngraph.Edges))
+	}
+	if len(result.NodeSources[0]) != 2 || result.NodeSources[0][1] != (GraphRef{1, c.ID}) {
+		t.Fatalf("bad node sources %v", result.NodeSources[0])
+	}
+	for _, edge := range ngraph.Edges {
+		if edge.Src.Point.Y > 9 && edge.Dst.Point.Y > 9 && edge.Src.Point.Y < 11 && edge.Dst.Point.Y < 11 {
+			if len(result.EdgeSources[edge.ID]) != 2 {
+				t.Fatalf("expected boundary edge %d to have two sources but got %v", edge.ID, result.EdgeSources[edge.ID])
+			}
+		}
+	}
+
+	// crossing roads from different tiles
+	g3 := &Graph{}
+	g3.AddBidirectionalEdge(g3.AddNode(Point{0, 0}), g3.AddNode(Point{4, 4}))
+	g4 := &Graph{}
+	g4.AddBidirectionalEdge(g4.AddNode(Point{0, 4}), g4.AddNode(Point{4, 0}))
+	result = MergeGraphs([]*Graph{g3, g4}, MergeOptions{SnapTolerance: 0.1, SplitCrossings: true})
+	if len(result.Graph.Nodes) != 5 || len(result.Graph.Edges) != 8 {
+		t.Fatalf("expected 5 nodes and 8 edges but got %d and %d", len(result.Graph.Nodes), len(result.Graph.Edges))
+	}
+	for _, edge := range result.Graph.Edges {
+		if len(result.EdgeSources[edge.ID]) != 1 {
+			t.Fatalf("expected edge %d to have one source but got %v", edge.ID, result.EdgeSources[edge.ID])
+		}
+	}
+
+	// a densely sampled road keeps all of its nodes, and the end of a road from another
+	// tile snaps to one of them
+	g5 := &Graph{}
+	prev := g5.AddNode(Point{0, 0})
+	for i := 1; i <= 10; i++ {
+		node := g5.AddNode(Point{float64(i), 0})
+		g5.AddBidirectionalEdge(prev, node)
+		prev = node
+	}
+	g6 := &Graph{}
+	g6.AddBidirectionalEdge(g6.AddNode(Point{5, 5}), g6.AddNode(Point{5, 0.2}))
+	result = MergeGraphs([]*Graph{g5, g6}, MergeOptions{SnapTolerance: 1.5})
+	if len(result.Graph.Nodes) != 12 || len(result.Graph.Edges) != 22 {
+		t.Fatalf("expected 12 nodes and 22 edges but got %d and %d", len(result.Graph.Nodes), len(result.Graph.Edges))
+	}
+	if len(result.NodeSources[5]) != 2 {
+		t.Fatalf("expected node 5 to be merged with the other road but got %v", result.NodeSources[5])
+	}
+}
+
+func TestCrop(t *testing.T) {
+	// a bidirectional road crossing the rectangle, and a one-way road that is inside
+	graph := &Graph{}
+	graph.AddBidirectionalEdge(graph.AddNode(Point{-5, 5}), graph.AddNode(Point{15, 5}))
+	graph.AddEdge(graph.AddNode(Point{2, 2}), graph.AddNode(Point{8, 2}))
+	r := Rect(0, 0, 10, 10)
+
+	old := graph.CropRect(r, CropOptions{NoClip: true})
+	if len(old.Nodes) != 2 || len(old.Edges) != 1 {
+		t.Fatalf("expected 2 nodes and 1 edge without clipping but got %d and %d", len(old.Nodes), len(old.Edges))
+	}
+
+	// the crossing road is clipped to two boundary nodes shared by both directions
+	ngraph := graph.GetSubgraphInRect(r)
+	if len(ngraph.Nodes) != 4 || len(ngraph.Edges) != 3 {
+		t.Fatalf("expected 4 nodes and 3 edges with clipping but got %d and %d", len(ngraph.Nodes), len(ngraph.Edges))
+	}
+	for _, node := range ngraph.Nodes[2:] {
+		if node.Point.Distance(Point{0, 5}) > 0.001 && node.Point.Distance(Point{10, 5}) > 0.001 {
+			t.Fatalf("unexpected boundary node at %v", node.Point)
+		}
+	}
+
+	// triangle that contains the left half of the crossing road
+	triangle := Polygon{{0, 0}, {0, 10}, {6, 5}}
+	ngraph = graph.Crop(triangle, CropOptions{})
+	if len(ngraph.Edges) != 3 {
+		t.Fatalf("expected 3 edges in triangle but got %d", len(ngraph.Edges))
+	}
+}
+
+func TestDiffGraphs(t *testing.T) {
+	// before: two bidirectional roads; after: the first road is shifted slightly and split
+	// into two edges, the second road is gone, and a third road is added
+	before := &Graph{}
+	before.AddBidirectionalEdge(before.AddNode(Point{0, 0}), before.AddNode(Point{100, 0}))
+	before.AddBidirectionalEdge(before.AddNode(Point{0, 50}), before.AddNode(Point{100, 50}))
+	after := &Graph{}
+	a := after.AddNode(Point{0, 1})
+	b := after.AddNode(Point{50, 1})
+	c := after.AddNode(Point{100, 0})
+	after.AddBidirectionalEdge(a, b)
+	after.AddBidirectionalEdge(b, c)
+	after.AddEdge(after.AddNode(Point{0, -50}), after.AddNode(Point{100, -50}))
+
+	diff, err := DiffGraphs(before, after, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.Stats.Moved != 4 || diff.Stats.Added != 1 || diff.Stats.Removed != 2 || diff.Stats.Unchanged != 0 {
+		t.Fatalf("bad diff stats %v", diff.Stats)
+	}
+	if math.Abs(diff.Stats.RemovedLength - 100) > 0.001 || math.Abs(diff.Stats.AddedLength - 100) > 0.001 {
+		t.Fatalf("bad diff lengths %v", diff.Stats)
+	}
+	if diff.Moved[0].Match == nil || diff.Moved[0].Match.Src.Point.Y != 0 {
+		t.Fatalf("bad match for moved edge")
+	}
+
+	diff, err = DiffGraphs(before, before, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.Stats.Unchanged != 4 || math.Abs(diff.Stats.UnchangedLength - 200) > 0.001 {
+		t.Fatalf("expected no changes but got %v", diff.Stats)
+	}
+	if len(diff.SVGElements()) != 4 {
+		t.Fatalf("expected one SVG layer per category")
+	}
+
+	for _, tolerance := range []float64{0, -1, math.NaN()} {
+		if _, err := DiffGraphs(before, before.Clone(), tolerance); err == nil {
+			t.Fatalf("expected error for tolerance %v", tolerance)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	// a junction with three arms, one of which has an intermediate node, plus a
+	// separate triangle
+	build := func(bidirectional bool) *Graph {
+		graph := &Graph{}
+		add := func(a *Node, b *Node) {
+			if bidirectional {
+				graph.AddBidirectionalEdge(a, b)
+			} else {
+				graph.AddEdge(a, b)
+			}
+		}
+		center := graph.AddNode(Point{0, 0})
+		mid := graph.AddNode(Point{10, 0})
+		add(center, mid)
+		add(mid, graph.AddNode(Point{20, 0}))
+		add(graph.AddNode(Point{0, 10}), center)
+		add(center, graph.AddNode(Point{0, -10}))
+		t1 := graph.AddNode(Point{100, 100})
+		t2 := graph.AddNode(Point{103, 100})
+		t3 := graph.AddNode(Point{100, 104})
+		add(t1, t2)
+		add(t2, t3)
+		add(t3, t1)
+		return graph
+	}
+	for _, bidirectional := range []bool{false, true} {
+		stats := build(bidirectional).Stats()
+		if stats.Bidirectional != bidirectional {
+			t.Fatalf("expected bidirectional=%v", bidirectional)
+		}
+		if stats.Roads != 7 || math.Abs(stats.RoadLength - 52) > 0.001 {
+			t.Fatalf("bad road stats %v", stats)
+		}
+		if stats.Junctions != 1 || stats.DeadEnds != 3 || stats.DegreeHistogram[2] != 4 {
+			t.Fatalf("bad degree stats %v", stats)
+		}
+		if stats.Components != 2 || stats.ComponentSizes[0] != 5 || stats.ComponentSizes[1] != 3 {
+			t.Fatalf("bad component stats %v", stats)
+		}
+		if stats.RoadSegments != 4 {
+			t.Fatalf("expected 4 road segments but got %d", stats.RoadSegments)
+		}
+		if stats.Bounds != Rect(0, -10, 103, 104) {
+			t.Fatalf("bad bounds %v", stats.Bounds)
+		}
+	}
+}
+
+func TestConsolidateIntersections(t *testing.T) {
+	// a divided road crossing a normal road: the crossing is represented by two
+	// junctions 4 apart, and there is a separate junction far away
+	graph := &Graph{}
+	west := graph.AddNode(Point{-50, 0})
+	east := graph.AddNode(Point{50, 0})
+	north := graph.AddNode(Point{0, 50})
+	south := graph.AddNode(Point{0, -50})
+	j1 := graph.AddNode(Point{0, 2})
+	j2 := graph.AddNode(Point{0, -2})
+	graph.AddEdge(west, j1)
+	graph.AddEdge(j1, east)
+	graph.AddEdge(east, j2)
+	graph.AddEdge(j2, west)
+	graph.AddBidirectionalEdge(north, j1)
+	graph.AddBidirectionalEdge(j1, j2)
+	graph.AddBidirectionalEdge(j2, south)
+	far := graph.AddNode(Point{200, 0})
+	graph.AddBidirectionalEdge(east, far)
+	graph.AddBidirectionalEdge(far, graph.AddNode(Point{200, 50}))
+	graph.AddBidirectionalEdge(far, graph.AddNode(Point{250, 0}))
+
+	ngraph, clusters, nodeMap := graph.ConsolidateIntersectionsWithMaps(10)
+	if len(clusters) != 1 || len(clusters[0].Members) != 2 {
+		t.Fatalf("expected one cluster with two members but got %v", clusters)
+	}
+	center := clusters[0].Node
+	if center.Point.Distance(Point{0, 0}) > 0.001 || nodeMap[j1.ID] != center || nodeMap[j2.ID] != center {
+		t.Fatalf("bad cluster node %v", center)
+	}
+	if len(ngraph.Nodes) != len(graph.Nodes) - 1 {
+		t.Fatalf("expected %d nodes but got %d", len(graph.Nodes) - 1, len(ngraph.Nodes))
+	}
+	// west->j1 and j2->west are reconnected to the center; the edge between j1 and j2 is removed
+	if ngraph.FindEdge(nodeMap[west.ID], center) == nil || ngraph.FindEdge(center, nodeMap[west.ID]) == nil {
+		t.Fatalf("expected west edges to be reconnected")
+	}
+	if len(ngraph.Edges) != len(graph.Edges) - 2 {
+		t.Fatalf("expected %d edges but got %d", len(graph.Edges) - 2, len(ngraph.Edges))
+	}
+}
+
+func TestRoadSegmentsDirected(t *testing.T) {
+	// a one-way road a->b->c, which continues as a bidirectional road c<->d<->e, and a
+	// self-loop at e
+	graph := &Graph{}
+	a := graph.AddNode(Point{0, 0})
+	b := graph.AddNode(Point{1, 0})
+	c := graph.AddNode(Point{2, 0})
+	d := graph.AddNode(Point{3, 0})
+	e := graph.AddNode(Point{4, 0})
+	graph.AddEdge(a, b)
+	graph.AddEdge(b, c)
+	graph.AddBidirectionalEdge(c, d)
+	graph.AddBidirectionalEdge(d, e)
+	graph.AddEdge(e, e)
+	// an isolated one-way loop
+	l1 := graph.AddNode(Point{0, 10})
+	l2 := graph.AddNode(Point{1, 10})
+	l3 := graph.AddNode(Point{0, 11})
+	graph.AddEdge(l1, l2)
+	graph.AddEdge(l2, l3)
+	graph.AddEdge(l3, l1)
+
+	roadSegments, err := graph.GetRoadSegments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a->c, c->e, e->c, the self-loop, and the isolated loop
+	if len(roadSegments) != 5 {
+		t.Fatalf("expected 5 road segments but got %d", len(roadSegments))
+	}
+	lengths := make(map[[2]int]int)
+	for _, rs := range roadSegments {
+		lengths[[2]int{rs.Src().ID, rs.Dst().ID}] = len(rs.Edges)
+	}
+	if lengths[[2]int{a.ID, c.ID}] != 2 || lengths[[2]int{c.ID, e.ID}] != 2 || lengths[[2]int{e.ID, c.ID}] != 2 || lengths[[2]int{e.ID, e.ID}] != 1 {
+		t.Fatalf("bad road segments %v", lengths)
+	}
+
+	ngraph, edgeMap, err := graph.Simplify(0.1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the one-way road stays one-way, and the bidirectional road stays bidirectional
+	if len(ngraph.Edges) != 1 + 2 + 1 + 3 {
+		t.Fatalf("expected 7 edges after simplifying but got %d", len(ngraph.Edges))
+	}
+	total := 0
+	for _, origIDs := range edgeMap {
+		total += len(origIDs)
+	}
+	if total != len(graph.Edges) {
+		t.Fatalf("expected all %d original edges to be mapped but got %d", len(graph.Edges), total)
+	}
+}
+
+func TestLinearReference(t *testing.T) {
+	// one bidirectional road from (0, 0) to (10, 0) through (5, 0)
+	graph := &Graph{}
+	a := graph.AddNode(Point{0, 0})
+	b := graph.AddNode(Point{5, 0})
+	c := graph.AddNode(Point{10, 0})
+	graph.AddBidirectionalEdge(a, b)
+	graph.AddBidirectionalEdge(b, c)
+	roadSegments, err := graph.GetRoadSegments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var forward RoadSegment
+	for _, rs := range roadSegments {
+		if rs.Src() == a {
+			forward = rs
+		}
+	}
+	lr := NewLinearReference(roadSegments)
+
+	var stop Attributes
+	stop.SetTag("type", "stop")
+	lr.AddPointEvent(SegmentPos{forward.ID, 7}, stop)
+	lr.AddPointEvent(SegmentPos{forward.ID, 2}, stop)
+	var speed Attributes
+	speed.SetValue("speed", 30)
+	lr.AddRangeEvent(forward.ID, 4, 8, speed)
+
+	if events := lr.PointEventsIn(forward.ID, 0, 5); len(events) != 1 || events[0].Offset != 2 {
+		t.Fatalf("bad point events %v", events)
+	}
+	if events := lr.RangeEventsIn(forward.ID, 8, 8); len(events) != 1 || events[0].Attributes.Values["speed"] != 30 {
+		t.Fatalf("bad range events %v", events)
+	}
+	if events := lr.RangeEventsIn(forward.ID, 0, 3); len(events) != 0 {
+		t.Fatalf("expected no range events but got %v", events)
+	}
+	if p := lr.Point(SegmentPos{forward.ID, 7}); p.Distance(Point{7, 0}) > 0.001 {
+		t.Fatalf("bad point %v", p)
+	}
+
+	pos, ok := lr.Project(Point{6, 0.5}, 1)
+	if !ok || math.Abs(lr.Segments[pos.SegmentID].Length() - 10) > 0.001 || math.Abs(lr.Point(pos).X - 6) > 0.001 {
+		t.Fatalf("bad projection %v", pos)
+	}
+	trace := &Trace{Observations: []*Observation{{Point: Point{1, 0.1}}, {Point: Point{1, 5}}}}
+	if positions := lr.ProjectTrace(trace, 1); positions[0].SegmentID == -1 || positions[1].SegmentID != -1 {
+		t.Fatalf("bad trace projection %v", positions)
+	}
+
+	// events stay at the same offsets after densifying
+	if _, err := graph.Densify(1); err != nil {
+		t.Fatal(err)
+	}
+	roadSegments, err = graph.GetRoadSegments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nlr, err := lr.Rebase(roadSegments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for segmentID := range nlr.PointEvents {
+		for _, event := range nlr.PointEvents[segmentID] {
+			total++
+			if nlr.Segments[segmentID].Src() != a {
+				t.Fatalf("event moved to the wrong segment")
+			}
+			if p := nlr.Point(event.SegmentPos); math.Abs(p.X - event.Offset) > 0.001 {
+				t.Fatalf("event at offset %v is at %v after rebasing", event.Offset, p)
+			}
+		}
+	}
+	if total != 2 {
+		t.Fatalf("expected 2 point events after rebasing but got %d", total)
+	}
+}
+
+func TestBinaryGraph(t *testing.T) {
+	graph := &Graph{}
+	a := graph.AddNode(Point{-71.09412345678912, 42.36012345678912})
+	b := graph.AddNode(Point{-71.09, 42.36})
+	graph.AddBidirectionalEdge(a, b)
+	graph.Edges[1].Attributes.SetTag("name", "Main St")
+	graph.Edges[1].Attributes.SetValue("width", 7.4)
+	b.Attributes.SetTag("highway", "traffic_signals")
+
+	dir, err := ioutil.TempDir("", "graph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "test" + GRAPH_BINARY_EXT)
+	if err := graph.Write(fname); err != nil {
+		t.Fatal(err)
+	}
+	other, err := ReadGraph(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(other.Nodes) != 2 || len(other.Edges) != 2 || other.Nodes[0].Point != a.Point {
+		t.Fatalf("graph was not read back exactly")
+	}
+	if other.Edges[1].Src.ID != b.ID || other.Edges[1].Attributes.Tags["name"] != "Main St" || other.Edges[1].Attributes.Values["width"] != 7.4 {
+		t.Fatalf("edge was not read back")
+	}
+	if other.Nodes[1].Attributes.Tags["highway"] != "traffic_signals" || !other.Edges[0].Attributes.IsEmpty() {
+		t.Fatalf("attributes were not read back")
+	}
+
+	// streaming read stops at the end of the graph
+	var buf bytes.Buffer
+	if err := graph.WriteBinaryTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteString("trailing")
+	if _, err := ReadBinaryGraph(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "trailing" {
+		t.Fatalf("expected reader to stop at the end of the graph")
+	}
+
+	// truncated input
+	buf.Reset()
+	graph.WriteBinaryTo(&buf)
+	if _, err := ReadBinaryGraph(bytes.NewReader(buf.Bytes()[:buf.Len() - 3])); err == nil {
+		t.Fatalf("expected error reading truncated graph")
+	}
+
+	// corrupted string length
+	corrupted := append([]byte{}, buf.Bytes()...)
+	i := bytes.Index(corrupted, []byte("highway"))
+	copy(corrupted[i - 4:i], []byte{0xff, 0xff, 0xff, 0xff})
+	if _, err := ReadBinaryGraph(bytes.NewReader(corrupted)); err == nil {
+		t.Fatalf("expected error reading graph with corrupted string length")
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	// a nearly straight road with many intermediate nodes, and a second road that would be
+	// crossed if the bend near x=5 were removed
+	graph := &Graph{}
+	prev := graph.AddNode(Point{0, 0})
+	for i := 1; i <= 10; i++ {
+		y := 0.0
+		if i == 5 {
+			y = 0.5
+		}
+		cur := graph.AddNode(Point{float64(i), y})
+		graph.AddBidirectionalEdge(prev, cur)
+		prev = cur
+	}
+	graph.AddBidirectionalEdge(graph.AddNode(Point{5, 0.2}), graph.AddNode(Point{5, -3}))
+
+	ngraph, edgeMap, err := graph.Simplify(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the main road keeps its endpoints and the node at x=5 to avoid crossing the other road
+	if len(ngraph.Nodes) != 5 || len(ngraph.Edges) != 6 {
+		t.Fatalf("expected 5 nodes and 6 edges but got %d and %d", len(ngraph.Nodes), len(ngraph.Edges))
+	}
+	total := 0
+	for _, origIDs := range edgeMap {
+		total += len(origIDs)
+	}
+	if total != len(graph.Edges) {
+		t.Fatalf("expected all %d original edges to be mapped but got %d", len(graph.Edges), total)
+	}
+
+	// a two-way road that continues as a one-way road, and a node without edges
+	graph = &Graph{}
+	var nodes []*Node
+	for i := 0; i <= 3; i++ {
+		nodes = append(nodes, graph.AddNode(Point{float64(i), 0}))
+	}
+	for i := 1; i <= 3; i++ {
+		nodes = append(nodes, graph.AddNode(Point{3, float64(i)}))
+	}
+	for i := 1; i <= 3; i++ {
+		graph.AddBidirectionalEdge(nodes[i - 1], nodes[i])
+	}
+	for i := 4; i <= 6; i++ {
+		graph.AddEdge(nodes[i - 1], nodes[i])
+	}
+	graph.AddNode(Point{0, 10})
+	ngraph, _, err = graph.Simplify(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ngraph.Nodes) != 4 || len(ngraph.Edges) != 3 {
+		t.Fatalf("expected 4 nodes and 3 edges but got %d and %d", len(ngraph.Nodes), len(ngraph.Edges))
+	}
+	for _, edge := range ngraph.Edges {
+		if edge.Src.Point.Y > edge.Dst.Point.Y {
+			t.Fatalf("one-way part of the road became two-way: %v", edge)
+		}
+	}
+}
+
+func TestDensify(t *testing.T) {
+	graph := &Graph{}
+	a := graph.AddNode(Point{0, 0})
+	b := graph.AddNode(Point{10, 0})
+	c := graph.AddNode(Point{10, 1})
+	ab := graph.AddBidirectionalEdge(a, b)
+	bc := graph.AddEdge(b, c)
+
+	for _, maxLength := range []float64{0, -1, math.NaN()} {
+		if _, err := graph.Densify(maxLength); err == nil {
+			t.Fatalf("expected error for maxLength %v", maxLength)
+		}
+	}
+	origins, err := graph.Densify(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 10 / 3 -> 4 parts in each direction, and the short edge is untouched
+	if len(graph.Edges) != 9 || len(origins) != 9 {
+		t.Fatalf("expected 9 edges but got %d (%d origins)", len(graph.Edges), len(origins))
+	}
+	for _, edge := range graph.Edges {
+		if edge.Segment().Length() > 3 {
+			t.Fatalf("edge %v is longer than 3", edge)
+		}
+		origin := origins[edge.ID]
+		orig := graph.Edges[origin.EdgeID]
+		if origin.EdgeID == bc.ID {
+			continue
+		}
+		if edge.GetOpposite() == nil {
+			t.Fatalf("edge %v lost its opposite edge", edge)
+		}
+		var expected float64
+		if origin.EdgeID == ab[0].ID {
+			expected = edge.Src.Point.X
+		} else if origin.EdgeID == ab[1].ID {
+			expected = 10 - edge.Src.Point.X
+		} else {
+			t.Fatalf("bad origin %v for %v", origin, orig)
+		}
+		if math.Abs(origin.Offset - expected) > 0.001 {
+			t.Fatalf("expected offset %f for %v but got %f", expected, edge, origin.Offset)
+		}
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	graph := &Graph{}
+	a := graph.AddNode(Point{0, 0})
+	b := graph.AddNode(Point{10, 0})
+	edges := graph.AddBidirectionalEdge(a, b)
+	a.Attributes.SetTag("highway", "traffic_signals")
+	edges[0].Attributes.SetTag("name", "Main St")
+	edges[0].Attributes.SetValue("width", 7.4)
+
+	clone := graph.Clone()
+	clone.Edges[0].Attributes.SetValue("width", 3)
+	if width, _ := edges[0].Attributes.GetValue("width"); width != 7.4 {
+		t.Fatalf("modifying clone changed original attributes")
+	}
+
+	graph.SplitEdge(edges[0], 5)
+	for _, edge := range graph.Edges {
+		name, _ := edge.Attributes.GetTag("name")
+		if edge.Vector().X > 0 && name != "Main St" {
+			t.Fatalf("split edge %v lost its attributes", edge)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "graph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "test.graph")
+	if err := graph.Write(fname); err != nil {
+		t.Fatal(err)
+	}
+	other, err := ReadGraph(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag, _ := other.Nodes[0].Attributes.GetTag("highway"); tag != "traffic_signals" {
+		t.Fatalf("node attributes were not read back")
+	}
+	if width, ok := other.Edges[0].Attributes.GetValue("width"); !ok || width != 7.4 {
+		t.Fatalf("edge attributes were not read back")
+	}
+
+	// writing a graph without attributes to the same path deletes the stale sidecar
+	if _, err := os.Stat(fname + ".attrs"); err != nil {
+		t.Fatal(err)
+	}
+	plain := &Graph{}
+	plain.AddBidirectionalEdge(plain.AddNode(Point{0, 0}), plain.AddNode(Point{1, 0}))
+	if err := plain.Write(fname); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(fname + ".attrs"); !os.IsNotExist(err) {
+		t.Fatalf("expected %s.attrs to be deleted", fname)
+	}
+	other, err = ReadGraph(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !other.Nodes[0].Attributes.IsEmpty() {
+		t.Fatalf("expected no attributes")
+	}
+}
@@ -0,0 +1,196 @@
+package common
+
+import (
+	"container/heap"
+	"math"
+)
+
+// Edge-based routing: rather than searching over nodes, we search over edges so that the
+// cost of moving from one edge onto the next can depend on the turn between them.
+
+// Cost of turning from inEdge onto outEdge (where inEdge.Dst == outEdge.Src), in the same
+// units as the edge lengths. Return +Inf to forbid the turn.
+type TurnCostFunc func(inEdge *Edge, outEdge *Edge) float64
+
+// cost per radian of turning used by DefaultTurnCost
+const TURN_COST_PER_RADIAN = 10
+
+// Returns a TurnCostFunc that charges factor times the angle between the edges, and
+// uturnCost for turning back onto the node we came from (use +Inf to forbid U-turns).
+func AngleTurnCost(factor float64, uturnCost float64) TurnCostFunc {
+	return func(inEdge *Edge, outEdge *Edge) float64 {
+		if outEdge.Dst == inEdge.Src {
+			return uturnCost
+		}
+		return factor * inEdge.AngleTo(outEdge)
+	}
+}
+
+// Charges TURN_COST_PER_RADIAN for turns and forbids U-turns, like Viterbi2 in NewMode.
+func DefaultTurnCost(inEdge *Edge, outEdge *Edge) float64 {
+	return AngleTurnCost(TURN_COST_PER_RADIAN, math.Inf(1))(inEdge, outEdge)
+}
+
+type TurnShortestPathParams struct {
+	// MaxDistance, StopNodes and EdgeLengths behave as in ShortestPath.
+	// Distances include turn costs.
+	ShortestPathParams
+
+	// cost of each turn, or nil for no turn costs
+	TurnCost TurnCostFunc
+
+	// turns that are never allowed, as (in edge ID, out edge ID) pairs
+	BannedTurns map[[2]int]bool
+}
+
+func (params TurnShortestPathParams) getTurnCost(inEdge *Edge, outEdge *Edge) float64 {
+	if params.BannedTurns[[2]int{inEdge.ID, outEdge.ID}] {
+		return math.Inf(1)
+	} else if params.TurnCost == nil {
+		return 0
+	} else {
+		return params.TurnCost(inEdge, outEdge)
+	}
+}
+
+type TurnShortestPathResult struct {
+	source *Node
+	graph *Graph
+
+	// distance from the source to the end of each edge, +Inf if the edge was not reached
+	EdgeDistances []float64
+
+	// previous edge ID along the shortest path to each edge, -1 for edges leaving the
+	// source and for edges that were not reached
+	EdgeBackpointers []int
+}
+
+// Returns the reached edge into node with the smallest distance, or nil.
+func (result TurnShortestPathResult) bestEdgeTo(node *Node) *Edge {
+	var bestEdge *Edge
+	for _, edge := range node.In {
+		if math.IsInf(result.EdgeDistances[edge.ID], 1) {
+			continue
+		}
+		if bestEdge == nil || result.EdgeDistances[edge.ID] < result.EdgeDistances[bestEdge.ID] {
+			bestEdge = edge
+		}
+	}
+	return bestEdge
+}
+
+// Returns the distance from the source to node, or +Inf if it was not reached.
+func (result TurnShortestPathResult) DistanceTo(node *Node) float64 {
+	if node == result.source {
+		return 0
+	}
+	edge := result.bestEdgeTo(node)
+	if edge == nil {
+		return math.Inf(1)
+	}
+	return result.EdgeDistances[edge.ID]
+}
+
+// Returns the edges along the shortest path to node, or nil if it was not reached.
+func (result TurnShortestPathResult) GetEdgePathTo(node *Node) []*Edge {
+	if node == result.source {
+		return []*Edge{}
+	}
+	edge := result.bestEdgeTo(node)
+	if edge == nil {
+		return nil
+	}
+	var reverseSeq []*Edge
+	for edgeID := edge.ID; edgeID != -1; edgeID = result.EdgeBackpointers[edgeID] {
+		reverseSeq = append(reverseSeq, result.graph.Edges[edgeID])
+	}
+	path := make([]*Edge, len(reverseSeq))
+	for i, edge := range reverseSeq {
+		path[len(path) - i - 1] = edge
+	}
+	return path
+}
+
+// Returns the nodes along the shortest path to node, excluding the source (like
+// ShortestPathResult.GetPathTo). Unlike node-based paths, the same node may appear more
+// than once if a turn restriction forces a detour.
+func (result TurnShortestPathResult) GetPathTo(node *Node) []*Node {
+	edges := result.GetEdgePathTo(node)
+	if edges == nil {
+		return nil
+	}
+	path := make([]*Node, len(edges))
+	for i, edge := range edges {
+		path[i] = edge.Dst
+	}
+	return path
+}
+
+func (result TurnShortestPathResult) GetFullPathTo(node *Node) []*Node {
+	return append([]*Node{result.source}, result.GetPathTo(node)...)
+}
+
+// Edge-based Dijkstra from src, where moving from one edge to the next also costs
+// params.TurnCost and banned turns are never taken.
+func (graph *Graph) TurnShortestPath(src *Node, params TurnShortestPathParams) TurnShortestPathResult {
+	distances := make([]float64, len(graph.Edges))
+	finalized := make([]bool, len(graph.Edges))
+	backpointers := make([]int, len(graph.Edges))
+	for i := range graph.Edges {
+		distances[i] = math.Inf(1)
+		backpointers[i] = -1
+	}
+	stopNodes := make(map[int]bool)
+	for _, node := range params.StopNodes {
+		stopNodes[node.ID] = true
+	}
+
+	pq := &priorityQueue{}
+	for _, edge := range src.Out {
+		d := params.GetEdgeLength(edge)
+		if d < distances[edge.ID] {
+			distances[edge.ID] = d
+			heap.Push(pq, pqItem{edge.ID, d})
+		}
+	}
+	for pq.Len() > 0 {
+		item := heap.Pop(pq).(pqItem)
+		if finalized[item.id] || item.priority > distances[item.id] {
+			continue
+		} else if params.MaxDistance != 0 && item.priority > params.MaxDistance {
+			break
+		}
+		finalized[item.id] = true
+		edge := graph.Edges[item.id]
+		if stopNodes[edge.Dst.ID] {
+			break
+		}
+
+		for _, next := range edge.Dst.Out {
+			turnCost := params.getTurnCost(edge, next)
+			if math.IsInf(turnCost, 1) {
+				continue
+			}
+			d := item.priority + turnCost + params.GetEdgeLength(next)
+			if !finalized[next.ID] && d < distances[next.ID] {
+				distances[next.ID] = d
+				backpointers[next.ID] = edge.ID
+				heap.Push(pq, pqItem{next.ID, d})
+			}
+		}
+	}
+
+	// only keep settled edges in the result
+	for i := range graph.Edges {
+		if !finalized[i] {
+			distances[i] = math.Inf(1)
+			backpointers[i] = -1
+		}
+	}
+	return TurnShortestPathResult{
+		source: src,
+		graph: graph,
+		EdgeDistances: distances,
+		EdgeBackpointers: backpointers,
+	}
+}
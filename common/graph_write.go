@@ -0,0 +1,124 @@
+package common
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Writers for the map formats in graph_read.go.
+// The edge-list formats (Chicago, Kharita and Edelkamp) identify nodes by their
+// coordinates, so nodes without edges are dropped, and nodes at the same point are
+// merged when the graph is read back.
+
+func (graph *Graph) WriteChicagoMap(fname string) error {
+	return writeFile(fname, graph.WriteChicagoMapTo)
+}
+
+// Each edge is written as two "lat,lon" lines followed by a blank line.
+func (graph *Graph) WriteChicagoMapTo(w io.Writer) error {
+	writer := bufio.NewWriter(w)
+	for _, edge := range graph.Edges {
+		line := fmt.Sprintf("%f,%f\n%f,%f\n\n", edge.Src.Point.Y, edge.Src.Point.X, edge.Dst.Point.Y, edge.Dst.Point.X)
+		if _, err := writer.WriteString(line); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+func (graph *Graph) WriteDaviesMap(verticesFname string, edgesFname string) error {
+	return writeFile(verticesFname, func(verticesWriter io.Writer) error {
+		return writeFile(edgesFname, func(edgesWriter io.Writer) error {
+			return graph.WriteDaviesMapTo(verticesWriter, edgesWriter)
+		})
+	})
+}
+
+// The Davies format is undirected, so each pair of adjacent nodes is written once, and
+// one-way edges become bidirectional when the graph is read back.
+func (graph *Graph) WriteDaviesMapTo(verticesWriter io.Writer, edgesWriter io.Writer) error {
+	vertices := bufio.NewWriter(verticesWriter)
+	for _, node := range graph.Nodes {
+		line := fmt.Sprintf("%d %f %f\n", node.ID, node.Point.Y, node.Point.X)
+		if _, err := vertices.WriteString(line); err != nil {
+			return err
+		}
+	}
+	if err := vertices.Flush(); err != nil {
+		return err
+	}
+
+	edges := bufio.NewWriter(edgesWriter)
+	seen := make(map[[2]int]bool)
+	for _, edge := range graph.Edges {
+		k := [2]int{edge.Src.ID, edge.Dst.ID}
+		if k[0] > k[1] {
+			k = [2]int{k[1], k[0]}
+		}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		if _, err := edges.WriteString(fmt.Sprintf("%d %d\n", edge.Src.ID, edge.Dst.ID)); err != nil {
+			return err
+		}
+	}
+	return edges.Flush()
+}
+
+func (graph *Graph) WriteAhmedMap(verticesFname string, edgesFname string) error {
+	return writeFile(verticesFname, func(verticesWriter io.Writer) error {
+		return writeFile(edgesFname, func(edgesWriter io.Writer) error {
+			return graph.WriteAhmedMapTo(verticesWriter, edgesWriter)
+		})
+	})
+}
+
+// Vertices are written as "id,x,y,0" and edges as "id,src,dst".
+func (graph *Graph) WriteAhmedMapTo(verticesWriter io.Writer, edgesWriter io.Writer) error {
+	vertices := bufio.NewWriter(verticesWriter)
+	for _, node := range graph.Nodes {
+		line := fmt.Sprintf("%d,%f,%f,0\n", node.ID, node.Point.X, node.Point.Y)
+		if _, err := vertices.WriteString(line); err != nil {
+			return err
+		}
+	}
+	if err := vertices.Flush(); err != nil {
+		return err
+	}
+
+	edges := bufio.NewWriter(edgesWriter)
+	for _, edge := range graph.Edges {
+		line := fmt.Sprintf("%d,%d,%d\n", edge.ID, edge.Src.ID, edge.Dst.ID)
+		if _, err := edges.WriteString(line); err != nil {
+			return err
+		}
+	}
+	return edges.Flush()
+}
+
+func (graph *Graph) WriteKharitaMap(fname string) error {
+	return writeFile(fname, graph.WriteKharitaMapTo)
+}
+
+// Each edge is written as "lon lat , lon lat".
+func (graph *Graph) WriteKharitaMapTo(w io.Writer) error {
+	writer := bufio.NewWriter(w)
+	for _, edge := range graph.Edges {
+		line := fmt.Sprintf("%f %f , %f %f\n", edge.Src.Point.X, edge.Src.Point.Y, edge.Dst.Point.X, edge.Dst.Point.Y)
+		if _, err := writer.WriteString(line); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+func (graph *Graph) WriteEdelkampMap(fname string) error {
+	return writeFile(fname, graph.WriteEdelkampMapTo)
+}
+
+// Like the Chicago format, each edge is two "lat,lon" lines followed by a blank line.
+func (graph *Graph) WriteEdelkampMapTo(w io.Writer) error {
+	return graph.WriteChicagoMapTo(w)
+}
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"io"
@@ -74,6 +75,10 @@ type OSMOptions struct {
 	CustomBlacklist []string
 	CustomWhitelist []string
 	IncludeRailway bool
+
+	// Store node and way tags, and the road width (as the "width" value), in the
+	// Attributes of the graph nodes and edges.
+	Attributes bool
 }
 
 /*func LoadOSMMultiple(path string, regions []Rectangle, options OSMOptions) ([]*Graph, error) {
@@ -277,18 +282,25 @@ type OSMOptions struct {
 }*/
 
 
+// Decode OSM data from path (or options.Bytes if set), calling f with each decoded
+// object. Both PBF and XML (.osm) data are supported; the format is detected from the
+// content.
 func DecodeOSM(path string, options OSMOptions, f func(v interface{})) error {
-	var d *osmpbf.Decoder
+	var reader *bufio.Reader
 	if options.Bytes == nil {
 		file, err := os.Open(path)
 		if err != nil {
 			return fmt.Errorf("error opening %s: %v", path, err)
 		}
 		defer file.Close()
-		d = osmpbf.NewDecoder(file)
+		reader = bufio.NewReader(file)
 	} else {
-		d = osmpbf.NewDecoder(bytes.NewBuffer(options.Bytes))
+		reader = bufio.NewReader(bytes.NewBuffer(options.Bytes))
+	}
+	if isOSMXML(reader) {
+		return DecodeOSMXML(reader, f)
 	}
+	d := osmpbf.NewDecoder(reader)
 	d.SetBufferSize(osmpbf.MaxBlobSize)
 	nthreads := runtime.GOMAXPROCS(-1)
 	/*if nthreads > 1 {
@@ -374,6 +386,13 @@ func LoadOSMMultiple2(path string, regions []Rectangle, options OSMOptions) ([]*
 					options.NodeTags[rvertex.RegionID][rvertex.Vertex.ID] = v.Tags
 				}
 			}
+			if options.Attributes {
+				for _, rvertex := range nodeVertices {
+					for k, val := range v.Tags {
+						rvertex.Vertex.Attributes.SetTag(k, val)
+					}
+				}
+			}
 			if options.Verbose && count % 10000000 == 0 {
 				fmt.Printf("finished %dM vertices (%d/sec)\n", count / 1000000, count / int64(time.Now().Sub(vertexStartTime).Seconds() + 1))
 			}
@@ -477,7 +496,7 @@ func LoadOSMMultiple2(path string, regions []Rectangle, options OSMOptions) ([]*
 				lastVertexID = vertexID
 			}
 
-			if len(options.EdgeWidths) > 0 {
+			if len(options.EdgeWidths) > 0 || options.Attributes {
 				var width float64
 				if val, ok := v.Tags["lanes"]; ok {
 					lanes, _ := strconv.ParseFloat(strings.Split(val, ";")[0], 64)
@@ -492,7 +511,20 @@ func LoadOSMMultiple2(path string, regions []Rectangle, options OSMOptions) ([]*
 					width = 6.6
 				}
 				for _, redge := range wayEdges {
-					options.EdgeWidths[redge.RegionID][redge.Edge.ID] = width
+					if len(options.EdgeWidths) > 0 {
+						options.EdgeWidths[redge.RegionID][redge.Edge.ID] = width
+					}
+					if options.Attributes {
+						redge.Edge.Attributes.SetValue("width", width)
+					}
+				}
+			}
+
+			if options.Attributes {
+				for _, redge := range wayEdges {
+					for k, val := range v.Tags {
+						redge.Edge.Attributes.SetTag(k, val)
+					}
 				}
 			}
 
@@ -0,0 +1,68 @@
+package common
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestLoadOSMXML(t *testing.T) {
+	fname := "testdata/small.osm"
+	region := Rectangle{Point{-71.2, 42.2}, Point{-71.0, 42.4}}
+	options := OSMOptions{
+		OneWay: true,
+		Attributes: true,
+		EdgeWidths: []map[int]float64{make(map[int]float64)},
+		LayerEdges: []map[int]bool{make(map[int]bool)},
+	}
+	graphs, err := LoadOSMMultiple(fname, []Rectangle{region}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph := graphs[0]
+
+	// the node outside the region is dropped, along with the footway, the deleted way
+	// and the way leaving the region
+	if len(graph.Nodes) != 6 || len(graph.Edges) != 6 {
+		t.Fatalf("expected 6 nodes and 6 edges but got %d and %d", len(graph.Nodes), len(graph.Edges))
+	}
+	n := func(i int) *Node {
+		return graph.Nodes[i - 1]
+	}
+	if graph.FindEdge(n(3), n(4)) == nil || graph.FindEdge(n(4), n(3)) != nil {
+		t.Fatalf("expected one-way edge from 3 to 4")
+	}
+	if graph.FindEdge(n(4), n(6)) == nil || graph.FindEdge(n(6), n(4)) != nil {
+		t.Fatalf("expected motorway to be one-way")
+	}
+	edge := graph.FindEdge(n(2), n(1))
+	if edge == nil || options.EdgeWidths[0][edge.ID] != 7.4 {
+		t.Fatalf("expected bidirectional residential edge with width 7.4")
+	}
+	if name, _ := edge.Attributes.GetTag("name"); name != "Main Street" {
+		t.Fatalf("way tags were not stored")
+	}
+	if tag, _ := n(1).Attributes.GetTag("highway"); tag != "traffic_signals" {
+		t.Fatalf("node tags were not stored")
+	}
+	if len(options.LayerEdges[0]) != 1 || !options.LayerEdges[0][graph.FindEdge(n(4), n(6)).ID] {
+		t.Fatalf("expected only the motorway edge in LayerEdges, got %v", options.LayerEdges[0])
+	}
+
+	// same data from memory, with default one-way and blacklist handling
+	bytes, err := ioutil.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	graphs, err = LoadOSMMultiple("", []Rectangle{region}, OSMOptions{Bytes: bytes})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(graphs[0].Edges) != 8 {
+		t.Fatalf("expected 8 edges without one-way but got %d", len(graphs[0].Edges))
+	}
+	graphs, err = LoadOSMMultiple("", []Rectangle{region}, OSMOptions{Bytes: bytes, CustomWhitelist: []string{"footway"}})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(graphs[0].Edges) != 2 {
+		t.Fatalf("expected only the footway but got %d edges", len(graphs[0].Edges))
+	}
+}
@@ -0,0 +1,112 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"github.com/qedus/osmpbf"
+)
+
+type osmXMLTag struct {
+	Key string `xml:"k,attr"`
+	Value string `xml:"v,attr"`
+}
+
+// Nodes and ways in OSM XML files. Action is set in JOSM exports, where deleted
+// objects are kept with action="delete"; Visible is "false" for deleted objects in
+// history extracts.
+type osmXMLNode struct {
+	ID int64 `xml:"id,attr"`
+	Lat float64 `xml:"lat,attr"`
+	Lon float64 `xml:"lon,attr"`
+	Action string `xml:"action,attr"`
+	Visible string `xml:"visible,attr"`
+	Tags []osmXMLTag `xml:"tag"`
+}
+
+type osmXMLWay struct {
+	ID int64 `xml:"id,attr"`
+	Action string `xml:"action,attr"`
+	Visible string `xml:"visible,attr"`
+	Nds []struct {
+		Ref int64 `xml:"ref,attr"`
+	} `xml:"nd"`
+	Tags []osmXMLTag `xml:"tag"`
+}
+
+func osmXMLTags(tags []osmXMLTag) map[string]string {
+	m := make(map[string]string)
+	for _, tag := range tags {
+		m[tag.Key] = tag.Value
+	}
+	return m
+}
+
+// Decode OSM XML (.osm) data, calling f with an *osmpbf.Node or *osmpbf.Way for each
+// node and way, like the PBF decoder used by DecodeOSM. Relations are skipped, as are
+// deleted objects.
+func DecodeOSMXML(r io.Reader, f func(v interface{})) error {
+	d := xml.NewDecoder(r)
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("decode error: %v", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "node":
+			var node osmXMLNode
+			if err := d.DecodeElement(&node, &start); err != nil {
+				return fmt.Errorf("decode error: %v", err)
+			}
+			if node.Action == "delete" || node.Visible == "false" {
+				continue
+			}
+			f(&osmpbf.Node{
+				ID: node.ID,
+				Lat: node.Lat,
+				Lon: node.Lon,
+				Tags: osmXMLTags(node.Tags),
+			})
+		case "way":
+			var way osmXMLWay
+			if err := d.DecodeElement(&way, &start); err != nil {
+				return fmt.Errorf("decode error: %v", err)
+			}
+			if way.Action == "delete" || way.Visible == "false" {
+				continue
+			}
+			nodeIDs := make([]int64, len(way.Nds))
+			for i, nd := range way.Nds {
+				nodeIDs[i] = nd.Ref
+			}
+			f(&osmpbf.Way{
+				ID: way.ID,
+				Tags: osmXMLTags(way.Tags),
+				NodeIDs: nodeIDs,
+			})
+		case "relation":
+			if err := d.Skip(); err != nil {
+				return fmt.Errorf("decode error: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Returns whether the stream holds OSM XML rather than PBF, which always starts with the
+// (binary) length of the first blob header.
+func isOSMXML(reader *bufio.Reader) bool {
+	prefix, _ := reader.Peek(512)
+	prefix = bytes.TrimPrefix(prefix, []byte("\xef\xbb\xbf"))
+	prefix = bytes.TrimLeft(prefix, " \t\r\n")
+	return len(prefix) > 0 && prefix[0] == '<'
+}
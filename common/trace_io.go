@@ -19,7 +19,11 @@ func LoadCartelTraces(tracePath string) (Traces, error) {
 		return nil, fmt.Errorf("error opening %s: %v", tracePath, err)
 	}
 	defer file.Close()
-	reader := bufio.NewReader(file)
+	return LoadCartelTracesFrom(file)
+}
+
+func LoadCartelTracesFrom(r io.Reader) (Traces, error) {
+	reader := bufio.NewReader(r)
 
 	type ActiveTrace struct {
 		Trace *Trace
@@ -102,7 +106,11 @@ func LoadCMTTraces(tracePath string, rect *Rectangle, options CMTOptions) (Trace
 		return nil, fmt.Errorf("error opening %s: %v", tracePath, err)
 	}
 	defer file.Close()
-	reader := bufio.NewReader(file)
+	return LoadCMTTracesFrom(file, rect, options)
+}
+
+func LoadCMTTracesFrom(r io.Reader, rect *Rectangle, options CMTOptions) (Traces, error) {
+	reader := bufio.NewReader(r)
 
 	var traces Traces
 	var currentTrace *Trace
@@ -225,15 +233,71 @@ func LoadCMTTraces(tracePath string, rect *Rectangle, options CMTOptions) (Trace
 	}
 }*/
 
+// Text trace formats, each with one trace per file.
+type textTraceFormat struct {
+	delimiter string
+	expectedParts int
+	lonIdx int
+	latIdx int
+	tsIdx int
+}
+
+var chicagoTraceFormat = textTraceFormat{",", 4, 2, 1, 3}
+var defaultTraceFormat = textTraceFormat{" ", 3, 0, 1, 2}
+
 func LoadChicagoTraces(tracePath string) (Traces, error) {
-	return loadTextTraces(tracePath, ",", 4, 2, 1, 3)
+	return loadTextTraces(tracePath, chicagoTraceFormat)
 }
 
 func LoadTraces(tracePath string) (Traces, error) {
-	return loadTextTraces(tracePath, " ", 3, 0, 1, 2)
+	return loadTextTraces(tracePath, defaultTraceFormat)
+}
+
+// Load a single trace, in the format of one file in a LoadChicagoTraces directory.
+func LoadChicagoTraceFrom(r io.Reader, name string) (*Trace, error) {
+	return loadTextTrace(r, name, chicagoTraceFormat)
+}
+
+// Load a single trace, in the format of one file in a LoadTraces directory.
+func LoadTraceFrom(r io.Reader, name string) (*Trace, error) {
+	return loadTextTrace(r, name, defaultTraceFormat)
+}
+
+func loadTextTrace(r io.Reader, name string, format textTraceFormat) (*Trace, error) {
+	reader := bufio.NewReader(r)
+	trace := &Trace{Name: name}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				break
+			} else {
+				return nil, err
+			}
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		parts := strings.Split(line, format.delimiter)
+		if len(parts) < format.expectedParts {
+			return nil, fmt.Errorf("invalid line (bad parts): %s", line)
+		}
+		lon, lonerr := strconv.ParseFloat(parts[format.lonIdx], 64)
+		lat, laterr := strconv.ParseFloat(parts[format.latIdx], 64)
+		ts, tserr := strconv.ParseFloat(parts[format.tsIdx], 64)
+		if lonerr != nil || laterr != nil || tserr != nil {
+			return nil, fmt.Errorf("invalid line (%v %v %v): %s", lonerr, laterr, tserr, line)
+		}
+		trace.Observations = append(trace.Observations, &Observation{
+			Time: time.Unix(int64(ts), 0),
+			Point: Point{lon, lat},
+		})
+	}
+	return trace, nil
 }
 
-func loadTextTraces(tracePath string, delimiter string, expectedParts int, lonIdx int, latIdx int, tsIdx int) (Traces, error) {
+func loadTextTraces(tracePath string, format textTraceFormat) (Traces, error) {
 	var traces []*Trace
 
 	files, err := ioutil.ReadDir(tracePath)
@@ -241,39 +305,17 @@ func loadTextTraces(tracePath string, delimiter string, expectedParts int, lonId
 		return nil, fmt.Errorf("error reading %s: %v", tracePath, err)
 	}
 
-	loadTrace := func(file *os.File, name string) error {
+	loadTrace := func(fname string, name string) error {
+		file, err := os.Open(fname)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", fname, err)
+		}
 		defer file.Close()
-		reader := bufio.NewReader(file)
-		trace := Trace{Name: name}
-		for {
-			line, err := reader.ReadString('\n')
-			if err != nil {
-				if err == io.EOF {
-					break
-				} else {
-					return err
-				}
-			}
-			line = strings.TrimSpace(line)
-			if line == "" {
-				continue
-			}
-			parts := strings.Split(line, delimiter)
-			if len(parts) < expectedParts {
-				return fmt.Errorf("invalid line (bad parts): %s", line)
-			}
-			lon, lonerr := strconv.ParseFloat(parts[lonIdx], 64)
-			lat, laterr := strconv.ParseFloat(parts[latIdx], 64)
-			ts, tserr := strconv.ParseFloat(parts[tsIdx], 64)
-			if lonerr != nil || laterr != nil || tserr != nil {
-				return fmt.Errorf("invalid line (%v %v %v): %s", lonerr, laterr, tserr, line)
-			}
-			trace.Observations = append(trace.Observations, &Observation{
-				Time: time.Unix(int64(ts), 0),
-				Point: Point{lon, lat},
-			})
+		trace, err := loadTextTrace(file, name, format)
+		if err != nil {
+			return err
 		}
-		traces = append(traces, &trace)
+		traces = append(traces, trace)
 		return nil
 	}
 
@@ -281,11 +323,7 @@ func loadTextTraces(tracePath string, delimiter string, expectedParts int, lonId
 		if fileInfo.IsDir() || !strings.HasSuffix(fileInfo.Name(), ".txt") {
 			continue
 		}
-		file, err := os.Open(path.Join(tracePath, fileInfo.Name()))
-		if err != nil {
-			return nil, fmt.Errorf("error reading %s: %v", fileInfo.Name(), err)
-		}
-		if err := loadTrace(file, strings.Split(fileInfo.Name(), ".txt")[0]); err != nil {
+		if err := loadTrace(path.Join(tracePath, fileInfo.Name()), strings.Split(fileInfo.Name(), ".txt")[0]); err != nil {
 			return nil, err
 		}
 	}
@@ -293,71 +331,71 @@ func loadTextTraces(tracePath string, delimiter string, expectedParts int, lonId
 	return traces, nil
 }
 
-func SaveTraces(tracePath string, traces Traces) error {
-	saveTrace := func(fname string, trace *Trace) error {
-		file, err := os.Create(fname)
+// Save one trace per file, calling write to encode each trace.
+func saveTraceFiles(tracePath string, traces Traces, pattern string, write func(io.Writer, *Trace) error) error {
+	for i, trace := range traces {
+		fname := path.Join(tracePath, fmt.Sprintf(pattern, i))
+		err := writeFile(fname, func(w io.Writer) error {
+			return write(w, trace)
+		})
 		if err != nil {
-			return err
+			return fmt.Errorf("error writing %s: %v", fname, err)
 		}
-		defer file.Close()
-		for _, obs := range trace.Observations {
-			line := fmt.Sprintf("%f %f %d\n", obs.Point.X, obs.Point.Y, obs.Time.Unix())
-			file.Write([]byte(line))
-		}
-		return nil
 	}
+	return nil
+}
 
-	for i, trace := range traces {
-		fname := path.Join(tracePath, fmt.Sprintf("%d.txt", i))
-		if err := saveTrace(fname, trace); err != nil {
+func SaveTraces(tracePath string, traces Traces) error {
+	return saveTraceFiles(tracePath, traces, "%d.txt", SaveTraceTo)
+}
+
+// Write a single trace in the format read by LoadTraceFrom.
+func SaveTraceTo(w io.Writer, trace *Trace) error {
+	writer := bufio.NewWriter(w)
+	for _, obs := range trace.Observations {
+		line := fmt.Sprintf("%f %f %d\n", obs.Point.X, obs.Point.Y, obs.Time.Unix())
+		if _, err := writer.WriteString(line); err != nil {
 			return err
 		}
 	}
-
-	return nil
+	return writer.Flush()
 }
 
 func SaveChicagoTraces(tracePath string, traces Traces) error {
-	saveTrace := func(fname string, trace *Trace) error {
-		file, err := os.Create(fname)
-		if err != nil {
-			return err
-		}
-		defer file.Close()
-		for i, obs := range trace.Observations {
-			var prev, next string
-			if i - 1 < 0 {
-				prev = "None"
-			} else {
-				prev = strconv.Itoa(i - 1)
-			}
-			if i + 1 >= len(trace.Observations) {
-				next = "None"
-			} else {
-				next = strconv.Itoa(i + 1)
-			}
-			line := fmt.Sprintf("%d,%f,%f,%d,0,%s,%s\n", i, obs.Point.Y, obs.Point.X, obs.Time.Unix(), prev, next)
-			file.Write([]byte(line))
-		}
-		return nil
-	}
+	return saveTraceFiles(tracePath, traces, "trip_%d.txt", SaveChicagoTraceTo)
+}
 
-	for i, trace := range traces {
-		fname := path.Join(tracePath, fmt.Sprintf("trip_%d.txt", i))
-		if err := saveTrace(fname, trace); err != nil {
+// Write a single trace in the format read by LoadChicagoTraceFrom.
+func SaveChicagoTraceTo(w io.Writer, trace *Trace) error {
+	writer := bufio.NewWriter(w)
+	for i, obs := range trace.Observations {
+		var prev, next string
+		if i - 1 < 0 {
+			prev = "None"
+		} else {
+			prev = strconv.Itoa(i - 1)
+		}
+		if i + 1 >= len(trace.Observations) {
+			next = "None"
+		} else {
+			next = strconv.Itoa(i + 1)
+		}
+		line := fmt.Sprintf("%d,%f,%f,%d,0,%s,%s\n", i, obs.Point.Y, obs.Point.X, obs.Time.Unix(), prev, next)
+		if _, err := writer.WriteString(line); err != nil {
 			return err
 		}
 	}
-
-	return nil
+	return writer.Flush()
 }
 
 func SaveKharitaTraces(fname string, traces Traces) error {
-	file, err := os.Create(fname)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
+	return writeFile(fname, func(w io.Writer) error {
+		return SaveKharitaTracesTo(w, traces)
+	})
+}
+
+func SaveKharitaTracesTo(w io.Writer, traces Traces) error {
+	writer := bufio.NewWriter(w)
 	counter := 0
 	for traceID, trace := range traces {
 		for _, obs := range trace.Observations {
@@ -432,9 +470,11 @@ func SaveKharitaTraces(fname string, traces Traces) error {
 				obs.Point.Y,
 				heading,
 			)
-			file.Write([]byte(line))
+			if _, err := writer.WriteString(line); err != nil {
+				return err
+			}
 			counter++
 		}
 	}
-	return nil
+	return writer.Flush()
 }
@@ -0,0 +1,91 @@
+package common
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type failingWriter struct{}
+
+func (w failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestTraceIO(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	trace := &Trace{Observations: []*Observation{
+		{Time: start, Point: Point{-71.1, 42.3}},
+		{Time: start.Add(time.Second), Point: Point{-71.0, 42.4}},
+	}}
+
+	// round trip through gzip
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := SaveTraceTo(zw, trace); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := LoadTraceFrom(zr, "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Name != "0" || len(other.Observations) != 2 || other.Observations[1].Point != trace.Observations[1].Point || !other.Observations[1].Time.Equal(start.Add(time.Second)) {
+		t.Fatalf("trace was not read back: %v", other.Observations)
+	}
+
+	buf.Reset()
+	if err := SaveChicagoTraceTo(&buf, trace); err != nil {
+		t.Fatal(err)
+	}
+	other, err = LoadChicagoTraceFrom(&buf, "trip_0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(other.Observations) != 2 || other.Observations[0].Point != trace.Observations[0].Point {
+		t.Fatalf("Chicago trace was not read back: %v", other.Observations)
+	}
+
+	traces, err := LoadCartelTracesFrom(strings.NewReader("1500000000,a,42.3,-71.1,0,0\n1500000001,a,42.4,-71.0,0,0\n"))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(traces) != 1 || len(traces[0].Observations) != 2 {
+		t.Fatalf("expected one trace with two observations")
+	}
+
+	// write errors are surfaced
+	if err := SaveTraceTo(failingWriter{}, trace); err == nil {
+		t.Fatalf("expected error from SaveTraceTo")
+	}
+	if err := SaveChicagoTraceTo(failingWriter{}, trace); err == nil {
+		t.Fatalf("expected error from SaveChicagoTraceTo")
+	}
+	if err := SaveKharitaTracesTo(failingWriter{}, Traces{trace}); err == nil {
+		t.Fatalf("expected error from SaveKharitaTracesTo")
+	}
+
+	graph := &Graph{}
+	graph.AddBidirectionalEdge(graph.AddNode(Point{0, 0}), graph.AddNode(Point{1, 0}))
+	if err := graph.WriteTextTo(failingWriter{}); err == nil {
+		t.Fatalf("expected error from WriteTextTo")
+	}
+	buf.Reset()
+	if err := graph.WriteTextTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	otherGraph, err := ReadGraphFrom(&buf)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(otherGraph.Nodes) != 2 || len(otherGraph.Edges) != 2 {
+		t.Fatalf("graph was not read back")
+	}
+}
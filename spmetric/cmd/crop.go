@@ -11,8 +11,10 @@ import (
 
 var (
 	inFname = flag.String("in", "in.graph", "input filename")
-	outFname = flag.String("out", "out.graph", "output filename")
+	outFname = flag.String("out", "out.graph", "output filename (use .bgraph extension for binary format)")
 	rectStr = flag.String("rect", "", "e.g. 500,500,1000,1000")
+	polygonStr = flag.String("polygon", "", "crop to a polygon instead of a rectangle, e.g. 500,500,1000,500,750,1000")
+	noClip = flag.Bool("noclip", false, "drop edges that cross the boundary instead of clipping them")
 	originStr = flag.String("origin", "", "empty for no origin, e.g. 34,34 to convert to meters with origin")
 )
 
@@ -32,19 +34,30 @@ func main() {
 		graph.LonLatToMeters(origin)
 	}
 
-	parts := strings.Split(*rectStr, ",")
-	x1, _ := strconv.Atoi(parts[0])
-	y1, _ := strconv.Atoi(parts[1])
-	x2, _ := strconv.Atoi(parts[2])
-	y2, _ := strconv.Atoi(parts[3])
-	r := common.Rectangle{
-		common.Point{float64(x1), float64(y1)},
-		common.Point{float64(x2), float64(y2)},
-	}
-
+	options := common.CropOptions{NoClip: *noClip}
 	oldBounds := graph.Bounds()
 	oldCount := len(graph.Edges)
-	graph = graph.GetSubgraphInRect(r)
+	if *polygonStr != "" {
+		parts := strings.Split(*polygonStr, ",")
+		var polygon common.Polygon
+		for i := 0; i + 1 < len(parts); i += 2 {
+			x, _ := strconv.ParseFloat(parts[i], 64)
+			y, _ := strconv.ParseFloat(parts[i + 1], 64)
+			polygon = append(polygon, common.Point{x, y})
+		}
+		graph = graph.Crop(polygon, options)
+	} else {
+		parts := strings.Split(*rectStr, ",")
+		x1, _ := strconv.Atoi(parts[0])
+		y1, _ := strconv.Atoi(parts[1])
+		x2, _ := strconv.Atoi(parts[2])
+		y2, _ := strconv.Atoi(parts[3])
+		r := common.Rectangle{
+			common.Point{float64(x1), float64(y1)},
+			common.Point{float64(x2), float64(y2)},
+		}
+		graph = graph.CropRect(r, options)
+	}
 	fmt.Printf("cropped from bounds=%v, count=%d to bounds=%v, count=%d\n", oldBounds, oldCount, graph.Bounds(), len(graph.Edges))
 	if err := graph.Write(*outFname); err != nil {
 		panic(err)
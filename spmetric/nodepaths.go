@@ -41,6 +41,8 @@ func (g NodePathsGraph) GetShortestPath(src *common.Node, dst *common.Node, maxD
 	return path
 }
 
+// Read a graph along with the shortest paths from compute_shortest_paths in fname.sp/.
+// The graph may be in either format supported by common.ReadGraph.
 func ReadNodePathsGraph(fname string) (NodePathsGraph, error) {
 	graph, err := common.ReadGraph(fname)
 	if err != nil {